@@ -1,30 +1,90 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 
 	"mcp-sse-go/internal/server"
+	"mcp-sse-go/internal/tools/weather"
 )
 
 const defaultPort = "8080"
 
+// isTerminal reports whether f is attached to a terminal.
+var isTerminal = func(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// logWriter returns the log output for format: "console" for human-readable
+// lines, "json" for one JSON object per line, or empty to pick console on a
+// terminal and JSON otherwise, e.g. under a container log collector.
+func logWriter(format string, out *os.File) (io.Writer, error) {
+	if format == "" {
+		format = "json"
+		if isTerminal(out) {
+			format = "console"
+		}
+	}
+
+	switch format {
+	case "console":
+		return zerolog.ConsoleWriter{
+			Out:        out,
+			TimeFormat: "15:04:05",
+		}, nil
+	case "json":
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q: want console or json", format)
+	}
+}
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the server with the command-line arguments args, logging to
+// stderr, and returns the process exit code.
+func run(args []string, stdout io.Writer, stderr *os.File) int {
+	flags := flag.NewFlagSet("mcp-server", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	transport := flags.String("transport", "sse", "Transport to serve MCP over: sse or stdio")
+	checkConfig := flags.Bool("check-config", false, "Validate the configuration and exit without serving")
+	dumpTools := flags.Bool("dump-tools", false, "Print the tool definitions as JSON and exit without serving")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
 	// Configure logger
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.SetGlobalLevel(zerolog.DebugLevel) // Set to DebugLevel to see all logs
-	output := zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: "15:04:05",
+	output, err := logWriter(os.Getenv("LOG_FORMAT"), stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
 	}
 	logger := zerolog.New(output).
 		With().
 		Timestamp().
 		Caller().
 		Logger()
+	// Packages that log through the global logger share this configuration
+	log.Logger = logger
 	zerolog.CallerMarshalFunc = func(pc uintptr, file string, line int) string {
 		// Get relative path from the project root
 		short := file
@@ -38,31 +98,310 @@ func main() {
 		return fmt.Sprintf("%s:%d", file, line)
 	}
 
+	// Configuration
+	cfg := server.Config{
+		Logger:                 &logger,
+		WeatherAPIURL:          os.Getenv("WEATHER_API_URL"),
+		WeatherAmbiguityPolicy: weather.AmbiguityPolicy(os.Getenv("WEATHER_AMBIGUITY_POLICY")),
+		DisableWebUI:           os.Getenv("DISABLE_WEB_UI") == "true",
+		CompressResponses:      os.Getenv("COMPRESS_RESPONSES") == "true",
+		DebugPprof:             os.Getenv("DEBUG_PPROF") == "true",
+		DisableWeatherTool:     os.Getenv("DISABLE_WEATHER_TOOL") == "true",
+		PublicBaseURL:          os.Getenv("PUBLIC_BASE_URL"),
+		AuditLog:               os.Getenv("AUDIT_LOG"),
+		SessionWebhookURL:      os.Getenv("SESSION_WEBHOOK_URL"),
+	}
+	if keys := os.Getenv("API_KEYS"); keys != "" {
+		cfg.APIKeys = strings.Split(keys, ",")
+		cfg.APIKeyHeader = os.Getenv("API_KEY_HEADER")
+	}
+	if paths := os.Getenv("API_KEY_EXEMPT_PATHS"); paths != "" {
+		cfg.APIKeyExemptPaths = strings.Split(paths, ",")
+	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.TrustedProxies = strings.Split(proxies, ",")
+	}
+	if names := os.Getenv("SESSION_HEADER_ALIASES"); names != "" {
+		cfg.SessionHeaderAliases = strings.Split(names, ",")
+	}
+	if names := os.Getenv("ANONYMOUS_TOOLS"); names != "" {
+		cfg.AnonymousTools = strings.Split(names, ",")
+	}
+	if limit := os.Getenv("MAX_FAILED_SESSION_LOOKUPS"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			logger.Error().Err(err).Str("MAX_FAILED_SESSION_LOOKUPS", limit).Msg("Invalid session lookup limit")
+			return 1
+		}
+		cfg.MaxFailedSessionLookups = n
+	}
+	if rate := os.Getenv("SESSION_REQUEST_RATE"); rate != "" {
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			logger.Error().Err(err).Str("SESSION_REQUEST_RATE", rate).Msg("Invalid session request rate")
+			return 1
+		}
+		cfg.SessionRequestRate = r
+	}
+	if burst := os.Getenv("SESSION_REQUEST_BURST"); burst != "" {
+		n, err := strconv.Atoi(burst)
+		if err != nil {
+			logger.Error().Err(err).Str("SESSION_REQUEST_BURST", burst).Msg("Invalid session request burst")
+			return 1
+		}
+		cfg.SessionRequestBurst = n
+	}
+	if max := os.Getenv("MAX_SESSIONS"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil {
+			logger.Error().Err(err).Str("MAX_SESSIONS", max).Msg("Invalid maximum session count")
+			return 1
+		}
+		cfg.MaxSessions = n
+	}
+	if timeout := os.Getenv("SESSION_IDLE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			logger.Error().Err(err).Str("SESSION_IDLE_TIMEOUT", timeout).Msg("Invalid session idle timeout")
+			return 1
+		}
+		cfg.SessionIdleTimeout = d
+	}
+	if jitter := os.Getenv("SESSION_SWEEP_JITTER"); jitter != "" {
+		d, err := time.ParseDuration(jitter)
+		if err != nil {
+			logger.Error().Err(err).Str("SESSION_SWEEP_JITTER", jitter).Msg("Invalid session sweep jitter")
+			return 1
+		}
+		cfg.SessionSweepJitter = d
+	}
+	if window := os.Getenv("EVENT_REPLAY_WINDOW"); window != "" {
+		n, err := strconv.Atoi(window)
+		if err != nil {
+			logger.Error().Err(err).Str("EVENT_REPLAY_WINDOW", window).Msg("Invalid event replay window")
+			return 1
+		}
+		cfg.EventReplayWindow = n
+	}
+	if limit := os.Getenv("MAX_CONCURRENT_TOOL_CALLS"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			logger.Error().Err(err).Str("MAX_CONCURRENT_TOOL_CALLS", limit).Msg("Invalid tool concurrency limit")
+			return 1
+		}
+		cfg.MaxConcurrentToolCalls = n
+	}
+	if size := os.Getenv("MAX_TOOL_RESULT_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			logger.Error().Err(err).Str("MAX_TOOL_RESULT_SIZE", size).Msg("Invalid maximum tool result size")
+			return 1
+		}
+		cfg.MaxToolResultSize = n
+	}
+	if timeout := os.Getenv("TOOL_CALL_QUEUE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			logger.Error().Err(err).Str("TOOL_CALL_QUEUE_TIMEOUT", timeout).Msg("Invalid tool call queue timeout")
+			return 1
+		}
+		cfg.ToolCallQueueTimeout = d
+	}
+	if timeout := os.Getenv("REQUEST_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			logger.Error().Err(err).Str("REQUEST_TIMEOUT", timeout).Msg("Invalid request timeout")
+			return 1
+		}
+		cfg.RequestTimeout = d
+	}
+	if cooldown := os.Getenv("SESSION_LOOKUP_COOLDOWN"); cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil {
+			logger.Error().Err(err).Str("SESSION_LOOKUP_COOLDOWN", cooldown).Msg("Invalid session lookup cooldown")
+			return 1
+		}
+		cfg.SessionLookupCooldown = d
+	}
+	if interval := os.Getenv("METRICS_NOTIFICATION_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			logger.Error().Err(err).Str("METRICS_NOTIFICATION_INTERVAL", interval).Msg("Invalid metrics notification interval")
+			return 1
+		}
+		cfg.MetricsNotificationInterval = d
+	}
+	if threshold := os.Getenv("WEATHER_BREAKER_THRESHOLD"); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil {
+			logger.Error().Err(err).Str("WEATHER_BREAKER_THRESHOLD", threshold).Msg("Invalid circuit breaker threshold")
+			return 1
+		}
+		cfg.WeatherBreakerThreshold = n
+	}
+	if cooldown := os.Getenv("WEATHER_BREAKER_COOLDOWN"); cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil {
+			logger.Error().Err(err).Str("WEATHER_BREAKER_COOLDOWN", cooldown).Msg("Invalid circuit breaker cooldown")
+			return 1
+		}
+		cfg.WeatherBreakerCooldown = d
+	}
+	if ttl := os.Getenv("WEATHER_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			logger.Error().Err(err).Str("WEATHER_CACHE_TTL", ttl).Msg("Invalid cache TTL")
+			return 1
+		}
+		cfg.CacheToolResults = true
+		cfg.WeatherCacheTTL = d
+	}
+
+	if *checkConfig {
+		if *transport != "sse" && *transport != "stdio" {
+			logger.Error().Str("transport", *transport).Msg("Unknown transport")
+			return 1
+		}
+		if _, err := listenAddr(); err != nil {
+			logger.Error().Err(err).Msg("Invalid configuration")
+			return 1
+		}
+		if err := server.CheckConfig(cfg); err != nil {
+			logger.Error().Err(err).Msg("Invalid configuration")
+			return 1
+		}
+		logger.Info().Msg("Configuration is valid")
+		return 0
+	}
+
+	if *dumpTools {
+		defs, err := server.ToolDefinitions(cfg)
+		if err != nil {
+			logger.Error().Err(err).Msg("Invalid configuration")
+			return 1
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"tools": defs}); err != nil {
+			logger.Error().Err(err).Msg("Failed to write tool definitions")
+			return 1
+		}
+		return 0
+	}
+
+	switch *transport {
+	case "sse":
+	case "stdio":
+		return serveStdio(logger, cfg, stdout)
+	default:
+		logger.Error().Str("transport", *transport).Msg("Unknown transport")
+		return 1
+	}
+
+	addr, err := listenAddr()
+	if err != nil {
+		logger.Error().Err(err).Msg("Invalid configuration")
+		return 1
+	}
+
 	logger.Info().Msg("Starting MCP SSE server with debug logging")
 
-	// Configuration
-	cfg := server.Config{}
+	// Background work and the listener both stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg.Context = ctx
 
 	// Create server
 	handler, err := server.New(cfg)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("Failed to create server")
+		logger.Error().Err(err).Msg("Failed to create server")
+		return 1
+	}
+
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: handler,
 	}
+	// In-flight requests get to finish, but open streams never would, so
+	// end them as soon as shutdown starts instead of waiting out
+	// shutdownTimeout
+	httpServer.RegisterOnShutdown(handler.EndStreams)
+
+	// ListenAndServe returns as soon as shutdown starts, so wait for
+	// in-flight requests before exiting
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Info().Msg("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("Graceful shutdown failed")
+		}
+	}()
+
+	logger.Info().Str("addr", addr).Msg("Starting server")
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg("Server failed")
+		handler.Close()
+		return 1
+	}
+	<-shutdownDone
+	if err := handler.Close(); err != nil {
+		logger.Error().Err(err).Msg("Failed to close server")
+	}
+	return 0
+}
 
-	// Get port from environment variable or use default
+// listenAddr returns the address to listen on, from the PORT environment
+// variable or defaultPort.
+func listenAddr() (string, error) {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
 	}
-	addr := ":" + port
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port: %q", port)
+	}
+	return ":" + port, nil
+}
+
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+// before their connections are closed.
+const shutdownTimeout = 10 * time.Second
 
-	server := &http.Server{
-		Addr:     addr,
-		Handler:  handler,
+// serveStdio serves MCP over stdin and stdout. There are no request headers,
+// so the weather API settings come from the environment instead.
+func serveStdio(logger zerolog.Logger, cfg server.Config, stdout io.Writer) int {
+	handler, err := server.NewMCPHandler(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create MCP handler")
+		return 1
 	}
 
-	logger.Info().Str("addr", addr).Msg("Starting server")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal().Err(err).Msg("Server failed")
+	// Stops serving on SIGINT or SIGTERM as well as at the end of stdin
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if apiURL := os.Getenv("WEATHER_API_URL"); apiURL != "" {
+		ctx = context.WithValue(ctx, weather.ContextKeyAPIURL, apiURL)
+	}
+	if apiKey := os.Getenv("WEATHER_API_KEY"); apiKey != "" {
+		ctx = context.WithValue(ctx, weather.ContextKeyAPIKey, apiKey)
+	}
+
+	logger.Info().Msg("Starting MCP stdio server")
+	err = handler.ServeStdio(ctx, os.Stdin, stdout)
+	if closer, ok := handler.AuditSink().(io.Closer); ok {
+		closer.Close()
+	}
+	if errors.Is(err, context.Canceled) {
+		logger.Info().Msg("Stdio server stopped")
+		return 0
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Stdio server failed")
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// runMain runs the command with args and returns its exit code, standard
+// output and log output.
+func runMain(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+
+	t.Setenv("LOG_FORMAT", "json")
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	var stdout bytes.Buffer
+	code := run(args, &stdout, stderr)
+	logs, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, stdout.String(), string(logs)
+}
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		wantCode int
+		wantLog  string
+	}{
+		{
+			name:    "valid",
+			args:    []string{"-check-config"},
+			env:     map[string]string{"PORT": "9090", "REQUEST_TIMEOUT": "5s"},
+			wantLog: "Configuration is valid",
+		},
+		{
+			name:     "bad port",
+			args:     []string{"-check-config"},
+			env:      map[string]string{"PORT": "http"},
+			wantCode: 1,
+			wantLog:  `invalid port: \"http\"`,
+		},
+		{
+			name:     "unknown transport",
+			args:     []string{"-check-config", "-transport", "carrier-pigeon"},
+			wantCode: 1,
+			wantLog:  "Unknown transport",
+		},
+		{
+			name:     "negative timeout",
+			args:     []string{"-check-config"},
+			env:      map[string]string{"REQUEST_TIMEOUT": "-1s"},
+			wantCode: 1,
+			wantLog:  "request timeout must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PORT", "")
+			t.Setenv("REQUEST_TIMEOUT", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			code, _, logs := runMain(t, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d; logs:\n%s", code, tt.wantCode, logs)
+			}
+			if !strings.Contains(logs, tt.wantLog) {
+				t.Errorf("logs = %s, want them to contain %q", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		terminal    bool
+		wantConsole bool
+	}{
+		{name: "terminal", terminal: true, wantConsole: true},
+		{name: "not a terminal", terminal: false, wantConsole: false},
+		{name: "json on a terminal", format: "json", terminal: true, wantConsole: false},
+		{name: "console off a terminal", format: "console", terminal: false, wantConsole: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := isTerminal
+			isTerminal = func(*os.File) bool { return tt.terminal }
+			defer func() { isTerminal = orig }()
+
+			w, err := logWriter(tt.format, os.Stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, console := w.(zerolog.ConsoleWriter)
+			if console != tt.wantConsole {
+				t.Errorf("writer = %T, want console %v", w, tt.wantConsole)
+			}
+			if !console && w != io.Writer(os.Stderr) {
+				t.Errorf("writer = %T, want the file itself", w)
+			}
+		})
+	}
+
+	if _, err := logWriter("xml", os.Stderr); err == nil {
+		t.Error("logWriter(\"xml\") succeeded, want an error")
+	}
+}
+
+func TestDumpTools(t *testing.T) {
+	// Dumping definitions must not create the audit log
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("AUDIT_LOG", auditLog)
+	t.Setenv("DISABLE_WEATHER_TOOL", "")
+
+	code, stdout, logs := runMain(t, "-dump-tools")
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0; logs:\n%s", code, logs)
+	}
+	var dump struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &dump); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if len(dump.Tools) != 1 || dump.Tools[0].Name != "weather" || dump.Tools[0].InputSchema == nil {
+		t.Fatalf("tools = %+v, want the weather tool with its schema", dump.Tools)
+	}
+	if _, err := os.Stat(auditLog); !os.IsNotExist(err) {
+		t.Fatalf("audit log stat error = %v, want it not created", err)
+	}
+}
@@ -4,14 +4,15 @@ go 1.22.4
 
 require (
 	github.com/go-chi/chi/v5 v5.2.2
+	github.com/go-chi/cors v1.2.2
+	github.com/go-chi/render v1.0.3
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-isatty v0.0.19
 	github.com/rs/zerolog v1.34.0
 )
 
 require (
 	github.com/ajg/form v1.5.1 // indirect
-	github.com/go-chi/cors v1.2.2 // indirect
-	github.com/go-chi/render v1.0.3 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.19 // indirect
 	golang.org/x/sys v0.12.0 // indirect
 )
@@ -21,6 +21,25 @@ type Response struct {
 	Error   *Error          `json:"error,omitempty"`
 }
 
+// MarshalJSON emits exactly one of "result" or "error", as JSON-RPC 2.0
+// requires. A successful response keeps "result" even when it is null, and
+// the id is written as null when it is unknown, e.g. for parse errors.
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(struct {
+			JSONRPC string `json:"jsonrpc"`
+			ID      any    `json:"id"`
+			Error   *Error `json:"error"`
+		}{r.JSONRPC, r.ID, r.Error})
+	}
+
+	return json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      any    `json:"id"`
+		Result  any    `json:"result"`
+	}{r.JSONRPC, r.ID, r.Result})
+}
+
 type Notification struct {
 	JSONRPC string          `json:"jsonrpc"`
 	Method  string          `json:"method"`
@@ -35,6 +54,10 @@ const (
 	MethodNotFound ErrorCode = -32601
 	InvalidParams  ErrorCode = -32602
 	InternalError  ErrorCode = -32603
+
+	// RateLimited is an implementation-defined server error for clients
+	// that exceed their request rate.
+	RateLimited ErrorCode = -32000
 )
 
 type Error struct {
@@ -43,6 +66,27 @@ type Error struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// ErrorType classifies an error so clients can react to it without parsing
+// the human-readable message.
+type ErrorType string
+
+const (
+	ErrorTypeParse      ErrorType = "parse_error"
+	ErrorTypeValidation ErrorType = "validation_error"
+	ErrorTypeNotFound   ErrorType = "not_found"
+	ErrorTypeTool       ErrorType = "tool_error"
+	ErrorTypeRateLimit  ErrorType = "rate_limited"
+	ErrorTypeTimeout    ErrorType = "timeout"
+)
+
+// ErrorData is the conventional shape of Error.Data. Retryable tells the
+// client whether repeating the same request may succeed.
+type ErrorData struct {
+	Type      ErrorType `json:"type"`
+	Details   any       `json:"details,omitempty"`
+	Retryable bool      `json:"retryable"`
+}
+
 func (e *Error) Error() string {
 	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
 }
@@ -55,6 +99,33 @@ func NewError(code ErrorCode, message string, data interface{}) *Error {
 	}
 }
 
+// NewTypedError creates an error whose Data follows the ErrorData shape.
+func NewTypedError(code ErrorCode, message string, errType ErrorType, details any) *Error {
+	return NewError(code, message, &ErrorData{
+		Type:    errType,
+		Details: details,
+	})
+}
+
+// NewTimeoutError creates the error for a request that ran out of time,
+// which is worth retrying.
+func NewTimeoutError() *Error {
+	return NewError(InternalError, "Request timed out", &ErrorData{
+		Type:      ErrorTypeTimeout,
+		Retryable: true,
+	})
+}
+
+// NewRateLimitError creates the error for a client over its request rate,
+// which may retry after retryAfterSeconds.
+func NewRateLimitError(message string, retryAfterSeconds int) *Error {
+	return NewError(RateLimited, message, &ErrorData{
+		Type:      ErrorTypeRateLimit,
+		Details:   map[string]int{"retry_after_seconds": retryAfterSeconds},
+		Retryable: true,
+	})
+}
+
 func ParseMessage(data []byte) (interface{}, error) {
 	var msg struct {
 		JSONRPC string          `json:"jsonrpc"`
@@ -66,11 +137,11 @@ func ParseMessage(data []byte) (interface{}, error) {
 	}
 
 	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, NewError(ParseError, "Parse error", nil)
+		return nil, NewTypedError(ParseError, "Parse error", ErrorTypeParse, nil)
 	}
 
 	if msg.JSONRPC != Version {
-		return nil, NewError(InvalidRequest, "Invalid JSON-RPC version", nil)
+		return nil, NewTypedError(InvalidRequest, "Invalid JSON-RPC version", ErrorTypeValidation, nil)
 	}
 
 	// Check if it's a notification
@@ -102,5 +173,5 @@ func ParseMessage(data []byte) (interface{}, error) {
 		}, nil
 	}
 
-	return nil, NewError(InvalidRequest, "Invalid message", nil)
+	return nil, NewTypedError(InvalidRequest, "Invalid message", ErrorTypeValidation, nil)
 }
@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// wireError is an Error as a client decodes it.
+type wireError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Data    struct {
+		Type      ErrorType `json:"type"`
+		Details   any       `json:"details"`
+		Retryable bool      `json:"retryable"`
+	} `json:"data"`
+}
+
+// roundTrip marshals err and decodes it the way a client would.
+func roundTrip(t *testing.T, err *Error) wireError {
+	t.Helper()
+
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		t.Fatalf("failed to marshal %+v: %v", err, marshalErr)
+	}
+	var w wireError
+	if unmarshalErr := json.Unmarshal(data, &w); unmarshalErr != nil {
+		t.Fatalf("failed to decode %s: %v", data, unmarshalErr)
+	}
+	return w
+}
+
+func TestErrorShapes(t *testing.T) {
+	_, parseErr := ParseMessage([]byte(`{"jsonrpc":`))
+	var parse *Error
+	if !errors.As(parseErr, &parse) {
+		t.Fatalf("ParseMessage error = %v, want *Error", parseErr)
+	}
+
+	tests := []struct {
+		name     string
+		err      *Error
+		wantCode ErrorCode
+		wantType ErrorType
+		details  any
+	}{
+		{
+			name:     "parse",
+			err:      parse,
+			wantCode: ParseError,
+			wantType: ErrorTypeParse,
+		},
+		{
+			name:     "invalid params",
+			err:      NewTypedError(InvalidParams, "Invalid tool arguments", ErrorTypeValidation, "city is required"),
+			wantCode: InvalidParams,
+			wantType: ErrorTypeValidation,
+			details:  "city is required",
+		},
+		{
+			name:     "tool",
+			err:      NewTypedError(InternalError, "Tool result too large", ErrorTypeTool, "result is 2048 bytes"),
+			wantCode: InternalError,
+			wantType: ErrorTypeTool,
+			details:  "result is 2048 bytes",
+		},
+		{
+			name:     "rate limit",
+			err:      NewRateLimitError("Too many requests", 3),
+			wantCode: RateLimited,
+			wantType: ErrorTypeRateLimit,
+			details:  map[string]any{"retry_after_seconds": float64(3)},
+		},
+	}
+	for _, tt := range tests {
+		w := roundTrip(t, tt.err)
+		if w.Code != tt.wantCode || w.Message == "" {
+			t.Errorf("%s: code %d, message %q; want code %d and a message", tt.name, w.Code, w.Message, tt.wantCode)
+		}
+		if w.Data.Type != tt.wantType {
+			t.Errorf("%s: data.type = %q, want %q", tt.name, w.Data.Type, tt.wantType)
+		}
+		if !reflect.DeepEqual(w.Data.Details, tt.details) {
+			t.Errorf("%s: data.details = %#v, want %#v", tt.name, w.Data.Details, tt.details)
+		}
+	}
+}
+
+func TestErrorRetryable(t *testing.T) {
+	if w := roundTrip(t, NewTimeoutError()); w.Data.Type != ErrorTypeTimeout || !w.Data.Retryable {
+		t.Errorf("timeout error data = %+v, want retryable", w.Data)
+	}
+
+	badArgs := NewTypedError(InvalidParams, "Invalid tool arguments", ErrorTypeValidation, "lat out of range")
+	data, err := json.Marshal(badArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// retryable is always present, so clients need not guess at a default
+	var raw struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.Data["retryable"]) != "false" {
+		t.Errorf("bad arguments error = %s, want retryable false", data)
+	}
+}
+
+func TestResponseMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		resp Response
+		want string
+	}{
+		{
+			name: "null result",
+			resp: Response{JSONRPC: Version, ID: 1},
+			want: `{"jsonrpc":"2.0","id":1,"result":null}`,
+		},
+		{
+			name: "result",
+			resp: Response{JSONRPC: Version, ID: "a", Result: map[string]any{}},
+			want: `{"jsonrpc":"2.0","id":"a","result":{}}`,
+		},
+		{
+			name: "error omits result",
+			resp: Response{JSONRPC: Version, ID: 2, Result: "ignored", Error: NewError(InvalidRequest, "Invalid", nil)},
+			want: `{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"Invalid"}}`,
+		},
+		{
+			name: "unknown id",
+			resp: Response{JSONRPC: Version, Error: NewError(ParseError, "Parse error", nil)},
+			want: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`,
+		},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(&tt.resp)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/tools"
+)
+
+// Audit outcomes.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeError   = "error"
+)
+
+// AuditEntry records one tool execution. Arguments are only kept as a hash,
+// and credentials passed in headers are never recorded.
+type AuditEntry struct {
+	Time          time.Time     `json:"time"`
+	SessionID     string        `json:"session_id,omitempty"`
+	RequestID     string        `json:"request_id,omitempty"`
+	Tool          string        `json:"tool"`
+	ArgumentsHash string        `json:"arguments_sha256"`
+	Outcome       string        `json:"outcome"`
+	ErrorCode     string        `json:"error_code,omitempty"`
+	Duration      time.Duration `json:"duration_ns"`
+}
+
+// AuditSink receives an entry for every tool execution. Record is called on
+// the request path, so implementations should not block for long.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry)
+}
+
+// LogAuditSink writes audit entries as structured log lines.
+type LogAuditSink struct {
+	logger zerolog.Logger
+}
+
+// NewLogAuditSink creates a sink that logs through logger.
+func NewLogAuditSink(logger zerolog.Logger) *LogAuditSink {
+	return &LogAuditSink{logger: logger.With().Str("component", "audit").Logger()}
+}
+
+// Record implements AuditSink.
+func (s *LogAuditSink) Record(ctx context.Context, entry AuditEntry) {
+	s.logger.Info().
+		Time("time", entry.Time).
+		Str("session_id", entry.SessionID).
+		Str("request_id", entry.RequestID).
+		Str("tool", entry.Tool).
+		Str("arguments_sha256", entry.ArgumentsHash).
+		Str("outcome", entry.Outcome).
+		Str("error_code", entry.ErrorCode).
+		Dur("duration", entry.Duration).
+		Msg("Tool executed")
+}
+
+// JSONAuditSink writes each audit entry as a line of JSON, e.g. to a file.
+type JSONAuditSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewJSONAuditSink creates a sink that writes JSON lines to w.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{w: w}
+}
+
+// Close closes the underlying writer if it is an io.Closer, such as a file.
+func (s *JSONAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Record implements AuditSink.
+func (s *JSONAuditSink) Record(ctx context.Context, entry AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(data)
+}
+
+// SetAuditSink records every tool execution to sink. A nil sink disables
+// auditing.
+func (h *Handler) SetAuditSink(sink AuditSink) {
+	h.audit = sink
+}
+
+// AuditSink returns the sink set with SetAuditSink, or nil.
+func (h *Handler) AuditSink() AuditSink {
+	return h.audit
+}
+
+// recordAudit sends an entry for a tool call that started at start and
+// finished with err to the audit sink, if there is one.
+func (h *Handler) recordAudit(ctx context.Context, tool string, args json.RawMessage, start time.Time, err error) {
+	if h.audit == nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:          start,
+		RequestID:     middleware.GetReqID(ctx),
+		Tool:          tool,
+		ArgumentsHash: argumentsHash(args),
+		Outcome:       AuditOutcomeSuccess,
+		Duration:      time.Since(start),
+	}
+	entry.SessionID, _ = GetSessionIDFromContext(ctx)
+	if err != nil {
+		entry.Outcome = AuditOutcomeError
+		entry.ErrorCode = "error"
+		var toolErr *tools.Error
+		if errors.As(err, &toolErr) {
+			entry.ErrorCode = toolErr.Code
+		}
+	}
+	h.audit.Record(ctx, entry)
+}
+
+// argumentsHash returns the SHA-256 of the canonical form of args, so equal
+// arguments hash the same regardless of key order or spacing.
+func argumentsHash(args json.RawMessage) string {
+	if canonical, err := tools.CanonicalJSON(args); err == nil {
+		args = canonical
+	}
+	sum := sha256.Sum256(args)
+	return hex.EncodeToString(sum[:])
+}
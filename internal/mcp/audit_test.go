@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// fakeAuditSink keeps the entries it is given.
+type fakeAuditSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (s *fakeAuditSink) Record(ctx context.Context, entry AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func TestAuditRecordsEachToolCall(t *testing.T) {
+	h := newTestHandler(t)
+	sink := &fakeAuditSink{}
+	h.SetAuditSink(sink)
+	id := initializeStreamable(t, h)
+
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":1}}}`)
+	// Other methods are not tool executions
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 2 {
+		t.Fatalf("entries = %+v, want one per tool call", sink.entries)
+	}
+	for i, want := range []string{AuditOutcomeSuccess, AuditOutcomeError} {
+		e := sink.entries[i]
+		if e.Tool != "echo" || e.SessionID != id || e.Outcome != want || e.ArgumentsHash == "" {
+			t.Errorf("entry %d = %+v, want echo in session %s with outcome %s", i+1, e, id, want)
+		}
+	}
+	if code := sink.entries[1].ErrorCode; code != "invalid_arguments" {
+		t.Errorf("error code = %q, want invalid_arguments", code)
+	}
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+)
+
+// maxCompletionValues is the most candidates a completion/complete response
+// carries, as the MCP specification requires.
+const maxCompletionValues = 100
+
+// Completion reference types. The specification defines prompt and
+// resource references; this server has neither, so it answers them as
+// unknown. Tool references are an extension of this server, for completing
+// tool arguments.
+const (
+	completionRefPrompt   = "ref/prompt"
+	completionRefResource = "ref/resource"
+	completionRefTool     = "ref/tool"
+)
+
+// handleComplete suggests values for an argument of a tool implementing
+// tools.Completer.
+func (h *Handler) handleComplete(ctx context.Context, req *jsonrpc.Request) (any, *jsonrpc.Error) {
+	var params struct {
+		Ref struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+			URI  string `json:"uri"`
+		} `json:"ref"`
+		Argument struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"argument"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			"Invalid parameters",
+			jsonrpc.ErrorTypeValidation,
+			err.Error(),
+		)
+	}
+
+	switch params.Ref.Type {
+	case completionRefTool:
+	case completionRefPrompt:
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			fmt.Sprintf("Unknown prompt: %s", params.Ref.Name),
+			jsonrpc.ErrorTypeNotFound,
+			map[string]any{"prompt": params.Ref.Name},
+		)
+	case completionRefResource:
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			fmt.Sprintf("Unknown resource: %s", params.Ref.URI),
+			jsonrpc.ErrorTypeNotFound,
+			map[string]any{"resource": params.Ref.URI},
+		)
+	default:
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			fmt.Sprintf("Unsupported completion reference: %s", params.Ref.Type),
+			jsonrpc.ErrorTypeValidation,
+			map[string]any{"supported": []string{completionRefPrompt, completionRefResource, completionRefTool}},
+		)
+	}
+
+	tool, exists := h.toolRegistry.Get(params.Ref.Name)
+	if !exists {
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			fmt.Sprintf("Unknown tool: %s", params.Ref.Name),
+			jsonrpc.ErrorTypeNotFound,
+			map[string]any{"tool": params.Ref.Name},
+		)
+	}
+
+	// Tools that can't complete their arguments simply have no suggestions
+	values := []string{}
+	if completer, ok := tool.(tools.Completer); ok {
+		ctx, _, _ = withWeatherCredentials(ctx)
+		candidates, err := completer.Complete(ctx, params.Argument.Name, params.Argument.Value)
+		if err != nil {
+			h.log(ctx).Error().
+				Err(err).
+				Str("tool_name", params.Ref.Name).
+				Str("argument", params.Argument.Name).
+				Msg("Completion failed")
+			return nil, jsonrpc.NewTypedError(
+				jsonrpc.InternalError,
+				"Completion failed",
+				jsonrpc.ErrorTypeTool,
+				err.Error(),
+			)
+		}
+		if candidates != nil {
+			values = candidates
+		}
+	}
+
+	total := len(values)
+	if total > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return map[string]any{
+		"completion": map[string]any{
+			"values":  values,
+			"total":   total,
+			"hasMore": total > len(values),
+		},
+	}, nil
+}
@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+)
+
+// cityTool completes its city argument from cities.
+type cityTool struct {
+	*tools.DefaultTool
+	cities []string
+}
+
+func (t *cityTool) Complete(ctx context.Context, argument, prefix string) ([]string, error) {
+	if argument != "city" {
+		return nil, nil
+	}
+	var matches []string
+	for _, city := range t.cities {
+		if strings.HasPrefix(strings.ToLower(city), strings.ToLower(prefix)) {
+			matches = append(matches, city)
+		}
+	}
+	return matches, nil
+}
+
+// completionResult is the result of completion/complete.
+type completionResult struct {
+	Completion struct {
+		Values  []string `json:"values"`
+		Total   int      `json:"total"`
+		HasMore bool     `json:"hasMore"`
+	} `json:"completion"`
+}
+
+// newCompletionTransport serves a test handler that also has a city tool
+// completing cities over a MemoryTransport.
+func newCompletionTransport(t *testing.T, cities ...string) *MemoryTransport {
+	t.Helper()
+
+	h := newTestHandler(t)
+	h.toolRegistry.Register(&cityTool{tools.NewDefaultTool("city", "Looks up a city"), cities})
+
+	tr := h.NewMemoryTransport(context.Background())
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestCompleteToolArgument(t *testing.T) {
+	tr := newCompletionTransport(t, "London", "Los Angeles", "Paris")
+
+	var resp struct {
+		Result completionResult `json:"result"`
+		Error  *jsonrpc.Error   `json:"error"`
+	}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"completion/complete","params":{"ref":{"type":"ref/tool","name":"city"},"argument":{"name":"city","value":"lo"}}}`, &resp)
+	if resp.Error != nil {
+		t.Fatalf("error = %+v", resp.Error)
+	}
+	got := resp.Result.Completion
+	if fmt.Sprint(got.Values) != "[London Los Angeles]" || got.Total != 2 || got.HasMore {
+		t.Fatalf("completion = %+v, want London and Los Angeles", got)
+	}
+
+	// A tool that can't complete has no suggestions
+	resp.Result, resp.Error = completionResult{}, nil
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"completion/complete","params":{"ref":{"type":"ref/tool","name":"echo"},"argument":{"name":"text","value":"a"}}}`, &resp)
+	if resp.Error != nil || len(resp.Result.Completion.Values) != 0 {
+		t.Fatalf("echo completion = %+v, %+v; want no values", resp.Result, resp.Error)
+	}
+}
+
+func TestCompleteCapsValues(t *testing.T) {
+	cities := make([]string, maxCompletionValues+5)
+	for i := range cities {
+		cities[i] = fmt.Sprintf("City %d", i)
+	}
+	tr := newCompletionTransport(t, cities...)
+
+	var resp struct {
+		Result completionResult `json:"result"`
+	}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"completion/complete","params":{"ref":{"type":"ref/tool","name":"city"},"argument":{"name":"city","value":"City"}}}`, &resp)
+	got := resp.Result.Completion
+	if len(got.Values) != maxCompletionValues || got.Total != len(cities) || !got.HasMore {
+		t.Fatalf("completion has %d values, total %d, hasMore %v; want %d of %d and more", len(got.Values), got.Total, got.HasMore, maxCompletionValues, len(cities))
+	}
+}
+
+func TestCompleteReferences(t *testing.T) {
+	tr := newCompletionTransport(t)
+
+	tests := []struct {
+		name        string
+		ref         string
+		wantMessage string
+	}{
+		{name: "prompt", ref: `{"type":"ref/prompt","name":"greet"}`, wantMessage: "Unknown prompt: greet"},
+		{name: "resource", ref: `{"type":"ref/resource","uri":"file:///a"}`, wantMessage: "Unknown resource: file:///a"},
+		{name: "tool", ref: `{"type":"ref/tool","name":"missing"}`, wantMessage: "Unknown tool: missing"},
+		{name: "unsupported", ref: `{"type":"ref/agent","name":"x"}`, wantMessage: "Unsupported completion reference: ref/agent"},
+	}
+	for _, tt := range tests {
+		var resp rpcResponse
+		memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"completion/complete","params":{"ref":`+tt.ref+`,"argument":{"name":"a","value":""}}}`, &resp)
+		if resp.Error == nil || resp.Error.Message != tt.wantMessage {
+			t.Errorf("%s: error = %+v, want %q", tt.name, resp.Error, tt.wantMessage)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+	"mcp-sse-go/internal/version"
+)
+
+// rpcResponse is a JSON-RPC response with its result left undecoded.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *jsonrpc.Error  `json:"error"`
+}
+
+// failingTool always fails, as a tool whose upstream is down would.
+type failingTool struct {
+	*tools.DefaultTool
+}
+
+func (t *failingTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	return nil, errors.New("upstream unavailable")
+}
+
+// TestHandshakeConformance drives the MCP handshake in the order the spec
+// requires and checks each response has the shape the spec gives it.
+func TestHandshakeConformance(t *testing.T) {
+	h := newTestHandler(t)
+	h.toolRegistry.Register(&failingTool{tools.NewDefaultTool("fail", "Always fails")})
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	var resp rpcResponse
+
+	// initialize
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"conformance","version":"1.0"}}}`, &resp)
+	checkResult(t, "initialize", resp, "1")
+	var init struct {
+		ProtocolVersion string                     `json:"protocolVersion"`
+		Capabilities    map[string]json.RawMessage `json:"capabilities"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	decodeResult(t, resp, &init)
+	if init.ProtocolVersion != "2025-03-26" {
+		t.Errorf("protocolVersion = %q, want the requested 2025-03-26", init.ProtocolVersion)
+	}
+	if _, ok := init.Capabilities["tools"]; !ok {
+		t.Errorf("capabilities = %v, want tools", init.Capabilities)
+	}
+	if init.ServerInfo.Name != "mcp-sse-go" || init.ServerInfo.Version != version.Version {
+		t.Errorf("serverInfo = %+v, want mcp-sse-go %s", init.ServerInfo, version.Version)
+	}
+
+	// notifications/initialized is not answered, so the next response
+	// read must belong to tools/list
+	ctx := context.Background()
+	if err := tr.Send(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// tools/list
+	resp = rpcResponse{}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`, &resp)
+	checkResult(t, "tools/list", resp, "2")
+	var list struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			Description string         `json:"description"`
+			InputSchema map[string]any `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	decodeResult(t, resp, &list)
+	names := make(map[string]bool)
+	for _, tool := range list.Tools {
+		names[tool.Name] = true
+	}
+	if len(list.Tools) != 2 || !names["echo"] || !names["fail"] {
+		t.Fatalf("tools = %+v, want echo and fail", list.Tools)
+	}
+	for _, tool := range list.Tools {
+		if tool.Description == "" || tool.InputSchema["type"] != "object" {
+			t.Errorf("tool %s: description %q, inputSchema %v; want a description and an object schema", tool.Name, tool.Description, tool.InputSchema)
+		}
+	}
+
+	// tools/call
+	resp = rpcResponse{}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":"call","method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`, &resp)
+	checkResult(t, "tools/call", resp, `"call"`)
+	var result tools.Result
+	decodeResult(t, resp, &result)
+	if result.IsError || len(result.Content) != 1 {
+		t.Fatalf("tools/call result = %s, want one content block", resp.Result)
+	}
+	if c := result.Content[0]; c.Type != tools.ContentTypeText || c.Text != "hello" {
+		t.Fatalf("content = %+v, want the echoed text", c)
+	}
+}
+
+func TestToolCallErrorConformance(t *testing.T) {
+	h := newTestHandler(t)
+	h.toolRegistry.Register(&failingTool{tools.NewDefaultTool("fail", "Always fails")})
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	// A tool that fails reports it in the result, not as a protocol error
+	var resp rpcResponse
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"fail","arguments":{}}}`, &resp)
+	checkResult(t, "tools/call", resp, "1")
+	var result tools.Result
+	decodeResult(t, resp, &result)
+	if !result.IsError || len(result.Content) == 0 || result.Content[0].Type != tools.ContentTypeText {
+		t.Fatalf("result = %s, want isError with a text block", resp.Result)
+	}
+
+	// An unknown tool is a protocol error
+	resp = rpcResponse{}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"missing"}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidParams {
+		t.Fatalf("error = %+v, want invalid params", resp.Error)
+	}
+}
+
+func TestInitializeConformance(t *testing.T) {
+	tr := newMemoryTransport(t)
+
+	// Without a requested version the server offers its newest
+	var resp rpcResponse
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, &resp)
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	decodeResult(t, resp, &init)
+	if init.ProtocolVersion != SupportedProtocolVersions[0] {
+		t.Fatalf("protocolVersion = %q, want %q", init.ProtocolVersion, SupportedProtocolVersions[0])
+	}
+
+	resp = rpcResponse{}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidParams {
+		t.Fatalf("error = %+v, want invalid params for an unsupported version", resp.Error)
+	}
+	// The client learns which versions it could ask for instead
+	raw, err := json.Marshal(resp.Error.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Type    jsonrpc.ErrorType `json:"type"`
+		Details struct {
+			Requested string   `json:"requested"`
+			Supported []string `json:"supported"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatalf("failed to decode error data %s: %v", raw, err)
+	}
+	if data.Details.Requested != "1999-01-01" || !slices.Equal(data.Details.Supported, SupportedProtocolVersions) {
+		t.Fatalf("error data = %s, want the requested version and %v", raw, SupportedProtocolVersions)
+	}
+
+	resp = rpcResponse{}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":3,"method":"resources/list"}`, &resp)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.MethodNotFound {
+		t.Fatalf("error = %+v, want method not found", resp.Error)
+	}
+}
+
+// checkResult fails the test unless resp is a successful JSON-RPC 2.0
+// response to the request with the given id.
+func checkResult(t *testing.T, method string, resp rpcResponse, id string) {
+	t.Helper()
+
+	if resp.JSONRPC != jsonrpc.Version {
+		t.Fatalf("%s: jsonrpc = %q, want %q", method, resp.JSONRPC, jsonrpc.Version)
+	}
+	if string(resp.ID) != id {
+		t.Fatalf("%s: id = %s, want %s", method, resp.ID, id)
+	}
+	if resp.Error != nil {
+		t.Fatalf("%s: error %+v", method, resp.Error)
+	}
+}
+
+// decodeResult decodes resp's result into v.
+func decodeResult(t *testing.T, resp rpcResponse, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		t.Fatalf("failed to decode result %s: %v", resp.Result, err)
+	}
+}
+
+func TestInitializeWithoutHTTPRequest(t *testing.T) {
+	h := newTestHandler(t)
+
+	// As over stdio or in-process: nothing in the context names an HTTP request
+	req := &jsonrpc.Request{
+		JSONRPC: jsonrpc.Version,
+		ID:      1,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion":"2025-03-26","clientInfo":{"name":"test","version":"1.0"}}`),
+	}
+	result, rpcErr := h.handleInitialize(context.Background(), req)
+	if rpcErr != nil {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+	if result["protocolVersion"] != "2025-03-26" {
+		t.Fatalf("result = %v, want the requested protocol version", result)
+	}
+}
+
+func TestInitializeLogsClientInfo(t *testing.T) {
+	for _, protocolVersion := range SupportedProtocolVersions {
+		var logs bytes.Buffer
+		h := newTestHandler(t)
+		h.SetLogger(zerolog.New(&logs))
+
+		req := &jsonrpc.Request{
+			JSONRPC: jsonrpc.Version,
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion":"` + protocolVersion + `","clientInfo":{"name":"inspector","version":"0.9"}}`),
+		}
+		result, rpcErr := h.handleInitialize(context.Background(), req)
+		if rpcErr != nil {
+			t.Fatalf("%s: error = %+v", protocolVersion, rpcErr)
+		}
+		if result["protocolVersion"] != protocolVersion {
+			t.Errorf("%s: protocolVersion = %v, want it echoed", protocolVersion, result["protocolVersion"])
+		}
+		for _, field := range []string{`"client_name":"inspector"`, `"client_version":"0.9"`, `"protocol_version":"` + protocolVersion + `"`} {
+			if !strings.Contains(logs.String(), field) {
+				t.Errorf("%s: logs have no %s:\n%s", protocolVersion, field, logs.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// loggedEvent is a message sent on a session's stream, with its event id.
+type loggedEvent struct {
+	id   uint64
+	data []byte
+}
+
+// eventLog numbers the messages sent on a session's streams and keeps the
+// most recent ones, so a client reconnecting with Last-Event-ID can be sent
+// what it missed.
+type eventLog struct {
+	mu     sync.Mutex
+	nextID uint64
+	window int
+	events []loggedEvent
+}
+
+// append assigns data the next event id and, if the log keeps a window,
+// records it, evicting the oldest event once the window is full.
+func (l *eventLog) append(data []byte) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.nextID++
+	if l.window > 0 {
+		if len(l.events) == l.window {
+			l.events = append(l.events[:0], l.events[1:]...)
+		}
+		l.events = append(l.events, loggedEvent{id: l.nextID, data: data})
+	}
+	return l.nextID
+}
+
+// since returns the logged events after lastID. It reports false if events
+// after lastID have already been evicted, so replay would leave a gap.
+func (l *eventLog) since(lastID uint64) ([]loggedEvent, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lastID >= l.nextID {
+		return nil, true
+	}
+	if len(l.events) == 0 || l.events[0].id > lastID+1 {
+		return nil, false
+	}
+
+	start := int(lastID + 1 - l.events[0].id)
+	return append([]loggedEvent(nil), l.events[start:]...), true
+}
+
+// oldest returns the id of the oldest logged event, or zero if none is kept.
+func (l *eventLog) oldest() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == 0 {
+		return 0
+	}
+	return l.events[0].id
+}
+
+// SetEventReplayWindow keeps the last n messages sent on each session's
+// streams, so a Streamable HTTP client reopening its stream with
+// Last-Event-ID is sent the messages it missed. Zero disables replay. It
+// applies to sessions created afterwards, so it must be called before the
+// handler serves requests.
+func (h *Handler) SetEventReplayWindow(n int) {
+	h.sessions.replayWindow = n
+}
+
+// replayEvents sends the events after the client's Last-Event-ID on a
+// reopened stream. If some have already been evicted it sends a gap event
+// instead, telling the client its view may be incomplete.
+func (h *Handler) replayEvents(w http.ResponseWriter, flusher http.Flusher, sess *session, lastEventID string) error {
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		h.logger.Warn().Str("session_id", sess.id).Str("last_event_id", lastEventID).Msg("Ignoring invalid Last-Event-ID")
+		return nil
+	}
+
+	events, ok := sess.events.since(lastID)
+	if !ok {
+		h.logger.Warn().Str("session_id", sess.id).Uint64("last_event_id", lastID).Msg("Last-Event-ID is too old to replay")
+		gap := `{"requested":` + strconv.FormatUint(lastID, 10) + `,"oldest":` + strconv.FormatUint(sess.events.oldest(), 10) + `}`
+		return writeEvent(w, flusher, "gap", []byte(gap))
+	}
+
+	for _, e := range events {
+		if err := writeEventWithID(w, flusher, "message", e.id, e.data); err != nil {
+			return err
+		}
+	}
+	h.logger.Info().Str("session_id", sess.id).Int("events", len(events)).Msg("Replayed missed events")
+	return nil
+}
@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// openStreamable opens the Streamable HTTP GET stream for a session,
+// resuming after lastEventID if it is set. Calling the returned function
+// drops the connection.
+func openStreamable(t *testing.T, url, sessionID, lastEventID string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(SessionIDHeader, sessionID)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	return bufio.NewReader(resp.Body), cancel
+}
+
+// waitForNoStreams waits for the server to notice sess's streams have
+// dropped, so no message is taken by a stream that is going away.
+func waitForNoStreams(t *testing.T, sess *session) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sess.streams.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream still open after disconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLastEventIDReplay(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetEventReplayWindow(3)
+	srv := newTestServer(t, http.HandlerFunc(h.HandleStreamable))
+	id := initializeStreamable(t, h)
+	sess, _ := h.sessions.get(id)
+
+	stream, disconnect := openStreamable(t, srv.URL, id, "")
+	for i := 1; i <= 5; i++ {
+		sess.send(context.Background(), []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		if e := readSSEEvent(t, stream); e.id != fmt.Sprint(i) {
+			t.Fatalf("event id = %q, want %d", e.id, i)
+		}
+	}
+	disconnect()
+	waitForNoStreams(t, sess)
+
+	// The client saw up to 3 before the drop; 4 and 5 are still logged
+	stream, _ = openStreamable(t, srv.URL, id, "3")
+	for i := 4; i <= 5; i++ {
+		e := readSSEEvent(t, stream)
+		if e.id != fmt.Sprint(i) || e.data != fmt.Sprintf(`{"n":%d}`, i) {
+			t.Fatalf("replayed event = %+v, want id %d", e, i)
+		}
+	}
+
+	// New messages continue the numbering after the replay
+	sess.send(context.Background(), []byte(`{"n":6}`))
+	if e := readSSEEvent(t, stream); e.id != "6" {
+		t.Fatalf("event id after replay = %q, want 6", e.id)
+	}
+}
+
+func TestLastEventIDTooOld(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetEventReplayWindow(2)
+	srv := newTestServer(t, http.HandlerFunc(h.HandleStreamable))
+	id := initializeStreamable(t, h)
+	sess, _ := h.sessions.get(id)
+
+	stream, disconnect := openStreamable(t, srv.URL, id, "")
+	for i := 1; i <= 4; i++ {
+		sess.send(context.Background(), []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		readSSEEvent(t, stream)
+	}
+	disconnect()
+
+	// Event 2 has been evicted, so resuming after 1 would leave a gap
+	stream, _ = openStreamable(t, srv.URL, id, "1")
+	e := readSSEEvent(t, stream)
+	if e.event != "gap" || e.data != `{"requested":1,"oldest":3}` {
+		t.Fatalf("event = %+v, want a gap from 1 to 3", e)
+	}
+}
+
+func TestEventLogSince(t *testing.T) {
+	l := eventLog{window: 2}
+	for i := 0; i < 3; i++ {
+		l.append([]byte{byte(i)})
+	}
+
+	tests := []struct {
+		lastID uint64
+		want   []uint64
+		ok     bool
+	}{
+		{lastID: 0, ok: false},
+		{lastID: 1, want: []uint64{2, 3}, ok: true},
+		{lastID: 2, want: []uint64{3}, ok: true},
+		{lastID: 3, ok: true},
+		{lastID: 9, ok: true},
+	}
+	for _, tt := range tests {
+		events, ok := l.since(tt.lastID)
+		var ids []uint64
+		for _, e := range events {
+			ids = append(ids, e.id)
+		}
+		if ok != tt.ok || fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("since(%d) = %v, %v; want %v, %v", tt.lastID, ids, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// lookupLimiter protects the session registry from brute-force probing.
+// A client that presents limit unknown session ids within window is blocked
+// for cooldown, during which all of its session lookups are refused.
+type lookupLimiter struct {
+	limit    int
+	window   time.Duration
+	cooldown time.Duration
+	clients  map[string]*lookupWindow
+	mu       sync.Mutex
+	now      func() time.Time
+
+	// blocks counts how many times a client has been blocked
+	blocks atomic.Int64
+}
+
+// lookupWindow counts one client's failed lookups in the current window.
+type lookupWindow struct {
+	start        time.Time
+	failures     int
+	blockedUntil time.Time
+}
+
+// newLookupLimiter blocks a client for cooldown once it reaches limit
+// failed lookups within window.
+func newLookupLimiter(limit int, window, cooldown time.Duration) *lookupLimiter {
+	return &lookupLimiter{
+		limit:    limit,
+		window:   window,
+		cooldown: cooldown,
+		clients:  make(map[string]*lookupWindow),
+		now:      time.Now,
+	}
+}
+
+// blockedFor returns how much longer the client is blocked from lookups,
+// or zero if it may attempt another.
+func (l *lookupLimiter) blockedFor(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, exists := l.clients[client]
+	if !exists {
+		return 0
+	}
+	if remaining := w.blockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// fail records a failed lookup for the client, blocking it if this one
+// reaches the limit.
+func (l *lookupLimiter) fail(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, exists := l.clients[client]
+	if !exists || l.expired(w, now) {
+		l.prune(now)
+		w = &lookupWindow{start: now}
+		l.clients[client] = w
+	}
+
+	w.failures++
+	if w.failures >= l.limit {
+		w.blockedUntil = now.Add(l.cooldown)
+		w.failures = 0
+		w.start = w.blockedUntil
+		l.blocks.Add(1)
+	}
+}
+
+// expired reports whether w no longer affects the client: its counting
+// window has ended and any block has lapsed.
+func (l *lookupLimiter) expired(w *lookupWindow, now time.Time) bool {
+	return now.Sub(w.start) >= l.window && !now.Before(w.blockedUntil)
+}
+
+// prune drops clients with no live window or block. Callers must hold l.mu.
+func (l *lookupLimiter) prune(now time.Time) {
+	for client, w := range l.clients {
+		if l.expired(w, now) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// tokenBucket is a token-bucket rate limiter. The zero value starts full on
+// first use.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// take refills the bucket at rate tokens per second up to burst and takes a
+// token. If none is available it returns how long until one will be.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// tooManyRequests writes a 429 response telling the client to wait
+// retryAfter, rounded up to whole seconds, before trying again. The body is
+// the same JSON-RPC rate-limit error the WebSocket transport sends.
+func tooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := retryAfterSeconds(retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSONRPCError(w, http.StatusTooManyRequests, jsonrpc.NewRateLimitError(message, seconds))
+}
+
+// retryAfterSeconds rounds d up to whole seconds, with a minimum of one.
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// clientIP returns the address limits on r are keyed by: the one recorded
+// with WithClientIP, or else the host of RemoteAddr. RemoteAddr alone may
+// come from a client-supplied forwarding header, so servers behind the
+// RealIP middleware must record the address they trust.
+func clientIP(r *http.Request) string {
+	if ip, ok := GetClientIPFromContext(r.Context()); ok && ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
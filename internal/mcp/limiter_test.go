@@ -0,0 +1,201 @@
+package mcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postFrom POSTs a tools/list for sessionID to the Streamable HTTP endpoint
+// as if it came from remoteAddr.
+func postFrom(h *Handler, remoteAddr, sessionID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set(SessionIDHeader, sessionID)
+	rec := httptest.NewRecorder()
+	h.HandleStreamable(rec, req)
+	return rec
+}
+
+func TestFailedLookupsThrottled(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionLookupLimit(3, time.Minute, 0)
+
+	for i := 0; i < 3; i++ {
+		if rec := postFrom(h, "192.0.2.1:1234", "unknown"); rec.Code != http.StatusNotFound {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, http.StatusNotFound)
+		}
+	}
+
+	rec := postFrom(h, "192.0.2.1:5678", "unknown")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("429 response has no Retry-After")
+	}
+
+	// Another client is unaffected
+	if rec := postFrom(h, "192.0.2.2:1234", "unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("other client: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestFailedLookupsThrottleValidSessions(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionLookupLimit(2, time.Minute, 0)
+	id := initializeStreamable(t, h)
+
+	postFrom(h, "192.0.2.1:1234", "unknown")
+	postFrom(h, "192.0.2.1:1234", "unknown")
+
+	// While blocked, even a correct guess is refused
+	if rec := postFrom(h, "192.0.2.1:1234", id); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLookupLimitDisabled(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionLookupLimit(0, time.Minute, 0)
+
+	for i := 0; i < 20; i++ {
+		if rec := postFrom(h, "192.0.2.1:1234", "unknown"); rec.Code != http.StatusNotFound {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestBlockLiftsAfterCooldown(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionLookupLimit(2, time.Minute, 5*time.Minute)
+	now := time.Now()
+	h.lookupLimiter.now = func() time.Time { return now }
+
+	postFrom(h, "192.0.2.1:1234", "unknown")
+	postFrom(h, "192.0.2.1:1234", "unknown")
+	if got := h.Metrics().BlockedClients; got != 1 {
+		t.Fatalf("BlockedClients = %d, want 1", got)
+	}
+
+	// Still blocked once the window, but not the cooldown, has passed
+	now = now.Add(2 * time.Minute)
+	rec := postFrom(h, "192.0.2.1:1234", "unknown")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("during cooldown: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "180" {
+		t.Fatalf("Retry-After = %q, want 180", got)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if rec := postFrom(h, "192.0.2.1:1234", "unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("after cooldown: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestLookupsKeyedByRecordedClientIP(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionLookupLimit(2, time.Minute, 0)
+
+	// RemoteAddr varies as a spoofed forwarding header would make it, but
+	// the recorded client address does not
+	for i, addr := range []string{"198.51.100.1:1", "198.51.100.2:1", "198.51.100.3:1"} {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+		req.RemoteAddr = addr
+		req.Header.Set(SessionIDHeader, "unknown")
+		req = req.WithContext(WithClientIP(req.Context(), "192.0.2.1"))
+		rec := httptest.NewRecorder()
+		h.HandleStreamable(rec, req)
+
+		want := http.StatusNotFound
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
+
+func TestSessionRateLimit(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionRateLimit(0.001, 2)
+	flooding := initializeStreamable(t, h)
+	other := initializeStreamable(t, h)
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+
+	for i := 0; i < 2; i++ {
+		if rec := postStreamable(t, h, "", flooding, list); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	rec := postStreamable(t, h, "", flooding, list)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// One request per thousand seconds: the next token is due within that
+	if seconds, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || seconds < 1 || seconds > 1000 {
+		t.Fatalf("Retry-After = %q, want 1 to 1000 seconds", rec.Header().Get("Retry-After"))
+	}
+	// The body is the rate-limit error the WebSocket transport sends too
+	if body := rec.Body.String(); !strings.Contains(body, `"code":-32000`) || !strings.Contains(body, `"type":"rate_limited"`) {
+		t.Fatalf("429 body = %s, want a JSON-RPC rate limit error", body)
+	}
+
+	// The limit is per session
+	if rec := postStreamable(t, h, "", other, list); rec.Code != http.StatusOK {
+		t.Fatalf("other session: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestSessionRateLimitOverWebSocket(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionRateLimit(0.001, 1)
+	conn := dialWebSocket(t, h)
+
+	if resp := wsCall(t, conn, initializeRequest); resp["error"] != nil {
+		t.Fatalf("first request failed: %s", resp["error"])
+	}
+	resp := wsCall(t, conn, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if string(resp["id"]) != "2" || !strings.Contains(string(resp["error"]), `"type":"rate_limited"`) {
+		t.Fatalf("response = %v, want a rate limit error for id 2", resp)
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	var b tokenBucket
+	now := time.Now()
+
+	if ok, _ := b.take(now, 1, 1); !ok {
+		t.Fatal("first take from a full bucket failed")
+	}
+	ok, retryAfter := b.take(now, 1, 1)
+	if ok || retryAfter != time.Second {
+		t.Fatalf("take from an empty bucket = %v, %v; want false, 1s", ok, retryAfter)
+	}
+	if ok, _ := b.take(now.Add(time.Second), 1, 1); !ok {
+		t.Fatal("take after refilling failed")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{d: 0, want: 1},
+		{d: 10 * time.Millisecond, want: 1},
+		{d: time.Second, want: 1},
+		{d: 1500 * time.Millisecond, want: 2},
+		{d: 3 * time.Minute, want: 180},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.d); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
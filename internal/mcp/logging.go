@@ -0,0 +1,127 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// logLevels are the MCP log severities, least severe first. A session's log
+// level is an index into it.
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// serverLogLevels are the handler log levels matching logLevels. zerolog has
+// fewer levels, so several MCP severities share one. Nothing above warn is
+// reachable: a client may quiet the server's chatter, but never its warnings
+// and errors.
+var serverLogLevels = []zerolog.Level{
+	zerolog.DebugLevel, zerolog.InfoLevel, zerolog.InfoLevel, zerolog.WarnLevel,
+	zerolog.WarnLevel, zerolog.WarnLevel, zerolog.WarnLevel, zerolog.WarnLevel,
+}
+
+// Log severities used by the handler's own notifications.
+const (
+	logLevelInfo  = 1
+	logLevelError = 4
+)
+
+// logLevelOff is the level of a session that has not called logging/setLevel.
+// It is above every severity, so such sessions get no log notifications.
+var logLevelOff = int32(len(logLevels))
+
+// handleSetLevel sets the minimum severity the handler logs at and, for a
+// call made within a session, of the notifications/message log events sent
+// to that session. Transports without a session, such as stdio, have
+// nowhere to send log events, so only the handler's level changes for them.
+func (h *Handler) handleSetLevel(ctx context.Context, req *jsonrpc.Request) (any, *jsonrpc.Error) {
+	var params struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			"Invalid parameters",
+			jsonrpc.ErrorTypeValidation,
+			err.Error(),
+		)
+	}
+
+	level := slices.Index(logLevels, params.Level)
+	if level < 0 {
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidParams,
+			fmt.Sprintf("Invalid log level: %q", params.Level),
+			jsonrpc.ErrorTypeValidation,
+			map[string]any{"supported": logLevels},
+		)
+	}
+
+	// Logged before the change, so raising the level is always recorded
+	h.log(ctx).Info().Str("level", params.Level).Msg("Setting log level")
+	h.logLevel.Store(int32(serverLogLevels[level]))
+	if sess, ok := h.contextSession(ctx); ok {
+		sess.logLevel.Store(int32(level))
+	}
+	return map[string]any{}, nil
+}
+
+// notifyLog sends a notifications/message log event to the session ctx
+// belongs to, if its log level lets the event through. Delivery is best
+// effort, like other server-initiated notifications.
+func (h *Handler) notifyLog(ctx context.Context, level int, data any) {
+	sess, ok := h.contextSession(ctx)
+	if !ok || int32(level) < sess.logLevel.Load() || sess.streams.Load() == 0 {
+		return
+	}
+
+	params, err := json.Marshal(map[string]any{
+		"level":  logLevels[level],
+		"logger": "mcp-sse-go",
+		"data":   data,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal log notification")
+		return
+	}
+
+	msg, err := json.Marshal(&jsonrpc.Notification{
+		JSONRPC: jsonrpc.Version,
+		Method:  "notifications/message",
+		Params:  params,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal log notification")
+		return
+	}
+
+	if !sess.trySend(msg) {
+		h.logger.Debug().Str("session_id", sess.id).Msg("Dropped log notification")
+	}
+}
+
+// levelFilter discards log events below a level that can change at runtime,
+// on top of the level the logger was configured with.
+type levelFilter struct {
+	level *atomic.Int32
+}
+
+func (f levelFilter) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.Level(f.level.Load()) {
+		e.Discard()
+	}
+}
+
+// contextSession returns the open session ctx belongs to.
+func (h *Handler) contextSession(ctx context.Context) (*session, bool) {
+	id, ok := GetSessionIDFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return h.sessions.get(id)
+}
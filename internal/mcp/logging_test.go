@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// lockedBuffer is a bytes.Buffer safe to log to from several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSetLevelFiltersServerLogs(t *testing.T) {
+	h := newTestHandler(t)
+	var logs lockedBuffer
+	h.SetLogger(zerolog.New(&logs))
+	tr := h.NewMemoryTransport(context.Background())
+	t.Cleanup(func() { tr.Close() })
+
+	// stdio and memory transports have no session, but still set the level
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"logging/setLevel","params":{"level":"warning"}}`, &resp)
+	if resp.Error != nil || string(resp.Result) != "{}" {
+		t.Fatalf("setLevel response = %+v, want an empty result", resp)
+	}
+
+	h.logger.Info().Msg("filtered out")
+	h.logger.Warn().Msg("let through")
+	if out := logs.String(); strings.Contains(out, "filtered out") || !strings.Contains(out, "let through") {
+		t.Fatalf("logs = %q, want only the warning", out)
+	}
+
+	// No level quiets the server's warnings and errors
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"logging/setLevel","params":{"level":"emergency"}}`, &resp)
+	h.logger.Warn().Msg("still warned")
+	h.logger.Error().Msg("still failed")
+	if out := logs.String(); !strings.Contains(out, "still warned") || !strings.Contains(out, "still failed") {
+		t.Fatalf("logs = %q, want the warning and error after emergency", out)
+	}
+
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":3,"method":"logging/setLevel","params":{"level":"debug"}}`, &resp)
+	h.logger.Debug().Msg("debugging again")
+	if out := logs.String(); !strings.Contains(out, "debugging again") {
+		t.Fatalf("logs = %q, want the debug line after lowering the level", out)
+	}
+}
+
+func TestSetLevelRejectsUnknownLevel(t *testing.T) {
+	tr := newMemoryTransport(t)
+
+	var resp struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"logging/setLevel","params":{"level":"loud"}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != int(jsonrpc.InvalidParams) {
+		t.Fatalf("error = %+v, want invalid params", resp.Error)
+	}
+}
+
+func TestSetLevelFiltersNotifications(t *testing.T) {
+	h := newTestHandler(t)
+	srv := newTestServer(t, http.HandlerFunc(h.HandleStreamable))
+	id := initializeStreamable(t, h)
+	sess, _ := h.sessions.get(id)
+	stream, _ := openStreamable(t, srv.URL, id, "")
+	deadline := time.Now().Add(2 * time.Second)
+	for sess.streams.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream not open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":2,"method":"logging/setLevel","params":{"level":"error"}}`)
+	// A successful call logs at info, below the level; a failing one at error
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	postStreamable(t, h, "application/json", id, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{"text":1}}}`)
+
+	e := readSSEEvent(t, stream)
+	var msg struct {
+		Method string `json:"method"`
+		Params struct {
+			Level string `json:"level"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(e.data), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "notifications/message" || msg.Params.Level != "error" {
+		t.Fatalf("first notification = %s, want the error log event", e.data)
+	}
+}
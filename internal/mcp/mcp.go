@@ -2,19 +2,26 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"mcp-sse-go/internal/jsonrpc"
 	"mcp-sse-go/internal/tools"
 	"mcp-sse-go/internal/tools/weather"
+	"mcp-sse-go/internal/version"
 )
 
 // contextKey is a type for context keys.
@@ -23,12 +30,64 @@ type contextKey string
 const (
 	// HTTPRequestContextKey is the key used to store the HTTP request in the context.
 	HTTPRequestContextKey contextKey = "http_request"
+	// SessionIDContextKey is the key used to store the MCP session id in the context.
+	SessionIDContextKey contextKey = "session_id"
+	// ClientIPContextKey is the key used to store the trusted client address in the context.
+	ClientIPContextKey contextKey = "client_ip"
 )
 
+// sensitiveHeaders are request headers carrying credentials, by canonical
+// name. Their values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":     true,
+	"Cookie":            true,
+	"X-Api-Key":         true,
+	"X-Weather-Api-Key": true,
+}
+
+// redactedHeaders flattens header for logging, replacing the values of
+// sensitiveHeaders.
+func redactedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		if sensitiveHeaders[k] {
+			headers[k] = "[REDACTED]"
+			continue
+		}
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+// SupportedProtocolVersions lists the MCP protocol versions this server
+// speaks, newest first.
+var SupportedProtocolVersions = []string{"2025-03-26", "2024-11-05"}
+
 // Handler handles MCP protocol messages over HTTP.
 type Handler struct {
-	toolRegistry *tools.Registry
-	logger       zerolog.Logger
+	toolRegistry  *tools.Registry
+	sessions      *sessionRegistry
+	lookupLimiter *lookupLimiter
+	sessionRate   float64
+	sessionBurst  int
+	inFlight      atomic.Int64
+	brokenStreams atomic.Int64
+	audit         AuditSink
+	logger        zerolog.Logger
+	logLevel      atomic.Int32
+
+	// sessionHeaderAliases are read when Mcp-Session-Id is absent
+	sessionHeaderAliases []string
+
+	// publicBaseURL prefixes the endpoint announced to SSE clients
+	publicBaseURL string
+
+	// sweepJitter is the most that each idle-session sweep is delayed by
+	sweepJitter time.Duration
+
+	// closed ends open streams and WebSocket connections once Close is called
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // WithRequest adds the HTTP request to the context and returns the new context.
@@ -42,355 +101,601 @@ func GetRequestFromContext(ctx context.Context) (*http.Request, bool) {
 	return req, ok
 }
 
+// WithSessionID adds the MCP session id to the context and returns the new context.
+func WithSessionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, SessionIDContextKey, id)
+}
+
+// GetSessionIDFromContext retrieves the MCP session id from the context.
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(SessionIDContextKey).(string)
+	return id, ok
+}
+
+// WithClientIP adds the client address that per-client limits are keyed by
+// to the context and returns the new context.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ClientIPContextKey, ip)
+}
+
+// GetClientIPFromContext retrieves the client address from the context.
+func GetClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ClientIPContextKey).(string)
+	return ip, ok
+}
+
 // NewHandler creates a new MCP handler.
 func NewHandler(toolRegistry *tools.Registry) *Handler {
+	h := &Handler{
+		toolRegistry: toolRegistry,
+		sessions:     newSessionRegistry(),
+		closed:       make(chan struct{}),
+	}
+	h.logLevel.Store(int32(zerolog.TraceLevel))
+	h.SetLogger(log.Logger)
+
+	return h
+}
+
+// Close ends the handler's open SSE streams and WebSocket connections, which
+// would otherwise hold up a graceful shutdown until its deadline. Requests
+// that are not streaming are left to finish. Close is safe to call more
+// than once.
+func (h *Handler) Close() error {
+	h.closeOnce.Do(func() { close(h.closed) })
+	return nil
+}
+
+// SetLogger routes the handler's logs through logger instead of the global
+// zerolog logger. It must be called before the handler serves requests.
+func (h *Handler) SetLogger(logger zerolog.Logger) {
 	// Log the number of tools registered
-	toolList := toolRegistry.List()
-	logger := log.With().
+	toolList := h.toolRegistry.List()
+	logger = logger.With().
 		Str("component", "mcp_handler").
 		Int("tool_count", len(toolList)).
 		Caller().
 		Logger()
 
-	// Configure caller marshaling to show relative paths
-	zerolog.CallerMarshalFunc = func(pc uintptr, file string, line int) string {
-		// Get relative path from the project root
-		short := file
-		for i := len(file) - 1; i > 0; i-- {
-			if file[i] == '/' {
-				short = file[i+1:]
-				break
-			}
-		}
-		return fmt.Sprintf("%s:%d", short, line)
-	}
-
 	// Log each registered tool
 	for name := range toolList {
 		logger = logger.With().Str("tool_"+name, "registered").Logger()
 	}
+	h.logger = logger.Hook(levelFilter{&h.logLevel})
+}
+
+// log returns the handler's logger, tagged with the request id when ctx
+// belongs to an HTTP request that has one.
+func (h *Handler) log(ctx context.Context) *zerolog.Logger {
+	if id := middleware.GetReqID(ctx); id != "" {
+		logger := h.logger.With().Str("request_id", id).Logger()
+		return &logger
+	}
+	return &h.logger
+}
 
-	logger.Info().Msg("Created new MCP handler")
+// SetPublicBaseURL makes the endpoint event of legacy SSE streams an
+// absolute URL under baseURL, e.g. "https://mcp.example.com", rather than a
+// path relative to the stream's URL. It must be called before the handler
+// serves requests.
+func (h *Handler) SetPublicBaseURL(baseURL string) {
+	h.publicBaseURL = strings.TrimSuffix(baseURL, "/")
+}
 
-	return &Handler{
-		toolRegistry: toolRegistry,
-		logger:       logger,
+// SetSessionLookupLimit blocks an IP for cooldown once it presents limit
+// unknown session ids within window; while blocked its requests get 429.
+// A cooldown of zero blocks for one window. A limit of zero or less
+// disables the protection.
+func (h *Handler) SetSessionLookupLimit(limit int, window, cooldown time.Duration) {
+	if limit <= 0 {
+		h.lookupLimiter = nil
+		return
+	}
+	if cooldown <= 0 {
+		cooldown = window
+	}
+	h.lookupLimiter = newLookupLimiter(limit, window, cooldown)
+}
+
+// SetSessionRateLimit limits each session to rate requests per second with
+// bursts of up to burst. A rate of zero or less disables the limit.
+func (h *Handler) SetSessionRateLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	h.sessionRate = rate
+	h.sessionBurst = burst
+}
+
+// allowSessionRequest reports whether sess may send another request under
+// the per-session rate limit, and if not, how long until it may.
+func (h *Handler) allowSessionRequest(sess *session) (bool, time.Duration) {
+	if h.sessionRate <= 0 {
+		return true, 0
+	}
+	ok, retryAfter := sess.requests.take(time.Now(), h.sessionRate, h.sessionBurst)
+	if !ok {
+		h.logger.Warn().Str("session_id", sess.id).Msg("Session rate limit exceeded")
+	}
+	return ok, retryAfter
+}
+
+// resolveSession looks up a client-supplied session id. It writes a 429 if
+// the client has made too many failed lookups, or a 404 if the id is
+// unknown, and reports false in both cases.
+func (h *Handler) resolveSession(w http.ResponseWriter, r *http.Request, sessionID string) (*session, bool) {
+	ip := clientIP(r)
+	var blocked time.Duration
+	if h.lookupLimiter != nil {
+		blocked = h.lookupLimiter.blockedFor(ip)
+	}
+	if blocked > 0 {
+		h.log(r.Context()).Warn().Str("remote_ip", ip).Msg("Too many failed session lookups")
+		tooManyRequests(w, "Too many failed session lookups", blocked)
+		return nil, false
+	}
+
+	sess, ok := h.sessions.get(sessionID)
+	if !ok {
+		if h.lookupLimiter != nil {
+			h.lookupLimiter.fail(ip)
+		}
+		h.log(r.Context()).Warn().Str("session_id", sessionID).Str("remote_ip", ip).Msg("Unknown session")
+		writeJSONRPCError(w, http.StatusNotFound, jsonrpc.NewTypedError(
+			jsonrpc.InvalidRequest,
+			"Session not found",
+			jsonrpc.ErrorTypeNotFound,
+			sessionID,
+		))
+		return nil, false
 	}
+	return sess, true
 }
 
 // Handle handles incoming HTTP requests.
 func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info().
+	h.log(r.Context()).Info().
 		Str("method", r.Method).
 		Str("path", r.URL.Path).
 		Str("remote", r.RemoteAddr).
 		Str("user-agent", r.UserAgent()).
 		Msg("Incoming request")
 
-	// Log all headers for debugging
-	headers := make(map[string]string)
-	for k, v := range r.Header {
-		headers[k] = strings.Join(v, ", ")
-	}
-	h.logger.Debug().
-		Interface("headers", headers).
+	// Log all headers for debugging, except credentials
+	h.log(r.Context()).Debug().
+		Interface("headers", redactedHeaders(r.Header)).
 		Msg("Request headers")
 
-	// Set CORS headers for all responses
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Weather-API-URL, X-Weather-API-Key, Accept, Cache-Control")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	setCORSHeaders(w)
 
-	// Handle CORS preflight requests
-	if r.Method == http.MethodOptions {
-		h.logger.Info().Msg("Handling OPTIONS preflight request")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Weather-API-URL, X-Weather-API-Key, Accept, Cache-Control")
+	switch {
+	case r.Method == http.MethodOptions:
+		h.log(r.Context()).Info().Msg("Handling OPTIONS preflight request")
 		w.Header().Set("Access-Control-Max-Age", "86400")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Type, Authorization, X-Weather-API-URL, X-Weather-API-Key, Accept, Cache-Control")
+		w.Header().Set("Access-Control-Expose-Headers", corsHeaders)
 		w.WriteHeader(http.StatusOK)
-		return
+	case r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json"):
+		h.handleSSEPost(w, r)
+	case r.Method == http.MethodGet && acceptsEventStream(r):
+		h.handleSSEGet(w, r)
+	default:
+		h.log(r.Context()).Warn().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Msg("Method not allowed")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
+}
 
-	// Check if this is an SSE connection
-	isSSE := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+// corsHeaders are the request headers the legacy SSE endpoint allows.
+const corsHeaders = "Content-Type, Authorization, X-Weather-API-URL, X-Weather-API-Key, Accept, Cache-Control"
 
-	// Set up response headers for SSE if this is an SSE connection
-	if isSSE {
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
+// setCORSHeaders sets the CORS headers sent on every legacy SSE response.
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+}
+
+// acceptsEventStream reports whether the client accepts text/event-stream.
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// writeJSONRPCError answers an HTTP request that was refused before dispatch
+// with status and a JSON-RPC error response, whose id is unknown.
+func writeJSONRPCError(w http.ResponseWriter, status int, rpcErr *jsonrpc.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&jsonrpc.Response{
+		JSONRPC: jsonrpc.Version,
+		Error:   rpcErr,
+	})
+}
+
+// eventStreamFlusher returns w's flusher, writing an error response and
+// reporting false if w cannot stream.
+func eventStreamFlusher(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 	}
+	return flusher, ok
+}
 
-	// Get flusher for SSE if this is an SSE connection
+// handleSSEPost dispatches a JSON-RPC message. When the URL names an open SSE
+// session the response goes out on that stream; otherwise it is written in
+// the body, framed as prefersEventStream decides, as on /mcp.
+func (h *Handler) handleSSEPost(w http.ResponseWriter, r *http.Request) {
 	var flusher http.Flusher
-	if isSSE {
+	if prefersEventStream(r) {
 		var ok bool
-		flusher, ok = w.(http.Flusher)
-		if !ok {
-			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		if flusher, ok = eventStreamFlusher(w); !ok {
 			return
 		}
 	}
 
-	// Create context with request
-	ctx := WithRequest(r.Context(), r)
+	h.log(r.Context()).Info().
+		Bool("isSSE", flusher != nil).
+		Str("content-type", r.Header.Get("Content-Type")).
+		Msg("Handling JSON-RPC request")
 
-	// Handle POST requests (JSON-RPC messages)
-	if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-		h.logger.Info().
-			Bool("isSSE", isSSE).
-			Str("content-type", r.Header.Get("Content-Type")).
-			Msg("Handling JSON-RPC request")
-		
-		// Read the request body
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			h.logger.Error().Err(err).Msg("Failed to read request body")
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	// POSTs addressed to an open SSE stream get their response on that stream
+	ctx := WithRequest(r.Context(), r)
+	var sess *session
+	if sessionID := r.URL.Query().Get("sessionId"); sessionID != "" {
+		var ok bool
+		sess, ok = h.resolveSession(w, r, sessionID)
+		if !ok {
 			return
 		}
-
-		h.logger.Debug().
-			Str("body", string(body)).
-			Msg("Raw request body")
-		
-		// Parse the JSON-RPC request
-		var req jsonrpc.Request
-		if err := json.Unmarshal(body, &req); err != nil {
-			h.logger.Error().Err(err).Msg("Failed to decode JSON-RPC request")
-			http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		if ok, retryAfter := h.allowSessionRequest(sess); !ok {
+			tooManyRequests(w, "Too many requests", retryAfter)
 			return
 		}
+		ctx = WithSessionID(ctx, sess.id)
+	}
 
-		h.logger.Info().
-			Str("method", req.Method).
-			Interface("id", req.ID).
-			Msg("Parsed JSON-RPC request")
-
-		// Set up response headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		// Get flusher for SSE if this is an SSE connection
-		var flusher http.Flusher
-		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
-			var ok bool
-			flusher, ok = w.(http.Flusher)
-			if !ok {
-				http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-				return
-			}
-		}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	h.log(r.Context()).Debug().
+		Str("body", string(body)).
+		Msg("Raw request body")
 
-		// Use the existing context and flusher
+	var req jsonrpc.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to decode JSON-RPC request")
+		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
 
-		// Handle the initialization request
-		if req.Method == "initialize" {
-			h.logger.Info().Msg("Handling initialize request")
-			h.handleInitialize(w, flusher, &req, ctx)
+	h.log(r.Context()).Info().
+		Str("method", req.Method).
+		Interface("id", req.ID).
+		Msg("Parsed JSON-RPC request")
+
+	// Notifications carry no id and expect no response
+	if req.ID == nil {
+		h.handleNotification(&jsonrpc.Notification{
+			JSONRPC: req.JSONRPC,
+			Method:  req.Method,
+			Params:  req.Params,
+		})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp := h.dispatch(ctx, &req)
+
+	if sess != nil {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			h.log(r.Context()).Error().Err(err).Msg("Failed to marshal JSON response")
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
-
-		// Handle the tools/list request
-		if req.Method == "tools/list" {
-			h.logger.Info().Msg("Handling tools/list request")
-			h.handleToolsList(w, &req, ctx)
+		if !sess.send(ctx, data) {
+			// Out of time, the request timeout answers instead
+			if ctx.Err() != nil {
+				h.log(r.Context()).Warn().Err(ctx.Err()).Str("session_id", sess.id).Msg("Gave up queueing response")
+				return
+			}
+			http.Error(w, "Session closed", http.StatusGone)
 			return
 		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := h.sendJSONResponse(w, flusher, resp, "JSON-RPC response"); err != nil {
+		h.log(r.Context()).Error().Err(err).Str("method", req.Method).Msg("Failed to send response")
+	}
+}
+
+// handleSSEGet opens an SSE session, announces the endpoint its messages are
+// POSTed to and streams the session's messages until the client goes away.
+func (h *Handler) handleSSEGet(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := eventStreamFlusher(w)
+	if !ok {
+		return
+	}
 
-		// Handle other JSON-RPC methods
-		h.logger.Info().Str("method", req.Method).Msg("Handling JSON-RPC method")
-		h.handleRequest(w, flusher, &req, ctx)
+	sess, err := h.sessions.open()
+	if err != nil {
+		h.sessionOpenFailed(w, r, err)
+		return
+	}
+	// The session lives only as long as its stream, however that ends
+	defer func() {
+		h.sessions.close(sess.id)
+		h.log(r.Context()).Info().Str("session_id", sess.id).Msg("Cleaned up SSE session")
+	}()
+
+	h.log(r.Context()).Info().Str("session_id", sess.id).Msg("Handling SSE connection")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Tell the client where to POST its messages before anything else
+	endpoint := fmt.Sprintf("%s%s?sessionId=%s", h.publicBaseURL, r.URL.Path, sess.id)
+	if err := writeEvent(w, flusher, "endpoint", []byte(endpoint)); err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to send endpoint event")
 		return
 	}
 
-	// Handle GET requests (SSE connection)
-	if r.Method == http.MethodGet && isSSE {
-		// Handle SSE connection
-		h.logger.Info().Msg("Handling SSE connection")
+	h.streamSession(r.Context(), w, flusher, sess)
+}
+
+// streamSession writes the session's queued messages to an open SSE stream,
+// with periodic keep-alives, until ctx is done or a write fails.
+func (h *Handler) streamSession(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, sess *session) {
+	sess.streams.Add(1)
+	defer sess.streams.Add(-1)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
 
-		// Keep the connection open
-		for {
-			select {
-			case <-r.Context().Done():
-				h.logger.Info().Msg("SSE connection closed by client")
+	// Keep the connection open
+	for {
+		select {
+		case <-ctx.Done():
+			h.log(ctx).Info().Str("session_id", sess.id).Msg("SSE connection closed by client")
+			return
+		case <-sess.done:
+			h.log(ctx).Info().Str("session_id", sess.id).Msg("SSE session closed")
+			return
+		case <-h.closed:
+			h.log(ctx).Info().Str("session_id", sess.id).Msg("SSE stream closed for shutdown")
+			return
+		case msg := <-sess.messages:
+			// Numbered before writing, so a message lost to a failed write
+			// can still be replayed on reconnect
+			id := sess.events.append(msg)
+			if err := writeEventWithID(w, flusher, "message", id, msg); err != nil {
+				h.brokenStream(ctx, sess, "message", err)
+				return
+			}
+		case <-keepAlive.C:
+			// Send a keep-alive comment
+			_, err := fmt.Fprintf(w, ":keep-alive\n\n")
+			if err != nil {
+				h.brokenStream(ctx, sess, "keep-alive", err)
 				return
-			case <-time.After(30 * time.Second):
-				// Send a keep-alive comment
-				_, err := fmt.Fprintf(w, ":keep-alive\n\n")
-				if err != nil {
-					h.logger.Error().Err(err).Msg("Failed to send keep-alive")
-					return
-				}
-				flusher.Flush()
 			}
+			flusher.Flush()
 		}
 	}
+}
 
-	h.logger.Warn().
-		Str("method", r.Method).
-		Str("path", r.URL.Path).
-		Msg("Method not allowed")
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// brokenStream records a stream that failed mid-write, typically because the
+// client vanished without closing the connection. The caller owns the
+// session and decides whether it outlives the stream.
+func (h *Handler) brokenStream(ctx context.Context, sess *session, writing string, err error) {
+	h.brokenStreams.Add(1)
+	h.log(ctx).Warn().
+		Err(err).
+		Str("session_id", sess.id).
+		Str("writing", writing).
+		Msg("SSE stream broken")
+}
+
+// writeEvent writes a single named SSE event and flushes it.
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event string, data []byte) error {
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// writeEventWithID writes a single named SSE event with an event id, which
+// the client sends back as Last-Event-ID when it reconnects.
+func writeEventWithID(w http.ResponseWriter, flusher http.Flusher, event string, id uint64, data []byte) error {
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
 }
 
 // handleInitialize handles the initialize request according to MCP specification
-func (h *Handler) handleInitialize(w http.ResponseWriter, flusher http.Flusher, req *jsonrpc.Request, ctx context.Context) {
-    // Get the request from context
-    httpReq, _ := GetRequestFromContext(ctx)
-    
+func (h *Handler) handleInitialize(ctx context.Context, req *jsonrpc.Request) (map[string]any, *jsonrpc.Error) {
+    var params struct {
+        ProtocolVersion string `json:"protocolVersion"`
+        ClientInfo      struct {
+            Name    string `json:"name"`
+            Version string `json:"version"`
+        } `json:"clientInfo"`
+    }
+    if len(req.Params) > 0 {
+        if err := json.Unmarshal(req.Params, &params); err != nil {
+            return nil, jsonrpc.NewTypedError(
+                jsonrpc.InvalidParams,
+                "Invalid parameters",
+                jsonrpc.ErrorTypeValidation,
+                err.Error(),
+            )
+        }
+    }
+
+    // Clients that don't ask for a version get the newest one
+    protocolVersion := SupportedProtocolVersions[0]
+    if params.ProtocolVersion != "" {
+        if !slices.Contains(SupportedProtocolVersions, params.ProtocolVersion) {
+            h.log(ctx).Warn().
+                Str("requested", params.ProtocolVersion).
+                Strs("supported", SupportedProtocolVersions).
+                Msg("Unsupported protocol version")
+            return nil, jsonrpc.NewTypedError(
+                jsonrpc.InvalidParams,
+                "Unsupported protocol version",
+                jsonrpc.ErrorTypeValidation,
+                map[string]any{
+                    "requested": params.ProtocolVersion,
+                    "supported": SupportedProtocolVersions,
+                },
+            )
+        }
+        protocolVersion = params.ProtocolVersion
+    }
+
+    // Get the request from context. Transports other than HTTP don't set it,
+    // so fall back to placeholders rather than dereferencing a nil request.
+    remoteAddr, userAgent := "-", "-"
+    httpReq, ok := GetRequestFromContext(ctx)
+    if ok && httpReq != nil {
+        remoteAddr, userAgent = httpReq.RemoteAddr, httpReq.UserAgent()
+    }
+
     // Log detailed information about the initialize request
-    h.logger.Info().
+    h.log(ctx).Info().
         Str("method", req.Method).
         Interface("id", req.ID).
-        Str("remote_addr", httpReq.RemoteAddr).
-        Str("user_agent", httpReq.UserAgent()).
+        Str("remote_addr", remoteAddr).
+        Str("user_agent", userAgent).
+        Str("client_name", params.ClientInfo.Name).
+        Str("client_version", params.ClientInfo.Version).
+        Str("protocol_version", protocolVersion).
         Msg("Handling initialize request")
-        
-    // Log all headers for debugging
-    headers := make(map[string]string)
-    for k, v := range httpReq.Header {
-        headers[k] = strings.Join(v, ", ")
+
+    // Log all headers for debugging, except credentials
+    if ok && httpReq != nil {
+        h.log(ctx).Debug().
+            Interface("headers", redactedHeaders(httpReq.Header)).
+            Msg("Initialize request headers")
     }
-    h.logger.Debug().
-        Interface("headers", headers).
-        Msg("Initialize request headers")
 
     // List all registered tools
-    toolList := h.toolRegistry.List()
-    h.logger.Info().
+    toolList := h.toolRegistry.Sorted()
+    h.log(ctx).Info().
         Int("tool_count", len(toolList)).
         Msg("Found registered tools")
 
     tools := make([]map[string]any, 0, len(toolList))
     for _, tool := range toolList {
-        toolName := tool.Name()
-        h.logger.Debug().
-            Str("tool_name", toolName).
+        h.log(ctx).Debug().
+            Str("tool_name", tool.Name()).
             Msg("Including tool in list")
 
-        // Create a tool definition according to MCP specification
-        toolDef := map[string]any{
-            "name": toolName,
-            "annotations": map[string]interface{}{
-                "title":       fmt.Sprintf("%s Tool", toolName),
-                "openWorldHint": true,  // Indicates the tool interacts with external services
-            },
-        }
-
-        // Special case for weather tool
-        if toolName == "weather" {
-            toolDef["description"] = "Get current weather for a city"
-            toolDef["inputSchema"] = map[string]any{
-                "type": "object",
-                "properties": map[string]any{
-                    "city": map[string]any{
-                        "type":        "string",
-                        "description": "The city to get weather for",
-                    },
-                },
-                "required": []string{"city"},
-            }
-        } else {
-            // Default schema for other tools
-            toolDef["description"] = fmt.Sprintf("A tool named %s", toolName)
-            toolDef["inputSchema"] = map[string]any{
-                "type": "object",
-                "properties": map[string]any{
-                    "input": map[string]any{
-                        "type":        "string",
-                        "description": "Input for the tool",
-                    },
-                },
-                "required": []string{"input"},
-            }
-        }
-        tools = append(tools, toolDef)
+        // Use the same definition as tools/list so schemas and annotations agree
+        tools = append(tools, tool.GetToolDefinition())
     }
 
-    // Create the response with the expected MCP structure
-    response := map[string]any{
-        "jsonrpc": "2.0",
-        "id":      req.ID,
-        "result": map[string]any{
-            "protocolVersion": "2025-03-26",
-            "capabilities": map[string]any{
-                "tools": map[string]any{
-                    "listChanged": true,
-                },
-                "toolUse": map[string]any{
-                    "enabled": true,
-                },
+    // Create the result with the expected MCP structure
+    result := map[string]any{
+        "protocolVersion": protocolVersion,
+        "capabilities": map[string]any{
+            "tools": map[string]any{
+                "listChanged": true,
+            },
+            "toolUse": map[string]any{
+                "enabled": true,
             },
-            "serverInfo": map[string]any{
-                "name":    "mcp-sse-go",
-                "version": "0.1.0",
+            "completions": map[string]any{},
+            "logging": map[string]any{},
+            // notifications/metrics is not part of MCP
+            "experimental": map[string]any{
+                "metrics": map[string]any{},
             },
-            "tools": tools,  // Include tools in the initialization response
         },
+        "serverInfo": map[string]any{
+            "name":    "mcp-sse-go",
+            "version": version.Version,
+        },
+        "tools": tools,  // Include tools in the initialization response
     }
 
-    h.logger.Info().
-        Interface("response", response).
-        Msg("Sending initialize response")
-
-    // Set response headers
-    w.Header().Set("Content-Type", "application/json")
-    w.Header().Set("Access-Control-Allow-Origin", "*")
-    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-    w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Weather-API-Key, X-Weather-API-URL")
-    w.Header().Set("Access-Control-Allow-Credentials", "true")
-    w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-    w.Header().Set("Connection", "keep-alive")
-    w.Header().Set("X-Accel-Buffering", "no")  // Disable buffering for Nginx
-    
-    // Set status code before writing the body
-    w.WriteHeader(http.StatusOK)
-    
-    // Check if this is an OPTIONS preflight request
-    if httpReq != nil && httpReq.Method == "OPTIONS" {
-        h.logger.Info().Msg("Skipping response body for OPTIONS request")
-        return
-    }
-    
-    // Encode and send the response
-    enc := json.NewEncoder(w)
-    enc.SetIndent("", "  ")  // Pretty print for debugging
-    if err := enc.Encode(response); err != nil {
-        h.logger.Error().Err(err).Msg("Failed to write initialize response")
-        return
-    }
-    
-    // Flush the response if we have a flusher
-    if flusher != nil {
-        flusher.Flush()
-    }
-
-    h.logger.Info().
+    h.log(ctx).Info().
         Int("tool_count", len(tools)).
         Interface("tools", tools).
-        Msg("Successfully sent initialize response with tools")
+        Msg("Built initialize response with tools")
+
+    return result, nil
 }
 
-// handleToolsList handles the tools/list request according to MCP specification
-func (h *Handler) handleToolsList(w http.ResponseWriter, req *jsonrpc.Request, ctx context.Context) {
-    h.logger.Info().
+// handleToolsList handles the tools/list request according to MCP specification.
+// Tools are listed by name. A limit in the params pages the listing, and the
+// nextCursor of one page is passed back as the cursor for the next.
+func (h *Handler) handleToolsList(ctx context.Context, req *jsonrpc.Request) (map[string]any, *jsonrpc.Error) {
+    h.log(ctx).Info().
         Str("method", req.Method).
         Interface("id", req.ID).
         Msg("Handling tools/list request")
 
+    var params struct {
+        Cursor string `json:"cursor"`
+        Limit  int    `json:"limit"`
+    }
+    if len(req.Params) > 0 {
+        if err := json.Unmarshal(req.Params, &params); err != nil {
+            return nil, jsonrpc.NewTypedError(
+                jsonrpc.InvalidParams,
+                "Invalid parameters",
+                jsonrpc.ErrorTypeValidation,
+                err.Error(),
+            )
+        }
+    }
+
     // List all registered tools
-    toolList := h.toolRegistry.List()
-    h.logger.Info().
+    toolList := h.toolRegistry.Sorted()
+    h.log(ctx).Info().
         Int("tool_count", len(toolList)).
         Msg("Found registered tools")
 
+    // The cursor names the last tool already listed, so tools registered
+    // between pages neither repeat nor shift the rest of the listing
+    if params.Cursor != "" {
+        after, err := decodeCursor(params.Cursor)
+        if err != nil {
+            return nil, jsonrpc.NewTypedError(
+                jsonrpc.InvalidParams,
+                "Invalid cursor",
+                jsonrpc.ErrorTypeValidation,
+                err.Error(),
+            )
+        }
+        toolList = slices.DeleteFunc(toolList, func(tool tools.Tool) bool {
+            return tool.Name() <= after
+        })
+    }
+
+    var nextCursor string
+    if params.Limit > 0 && len(toolList) > params.Limit {
+        toolList = toolList[:params.Limit]
+        nextCursor = encodeCursor(toolList[len(toolList)-1].Name())
+    }
+
     tools := make([]map[string]any, 0, len(toolList))
     for _, tool := range toolList {
-        h.logger.Debug().
+        h.log(ctx).Debug().
             Str("tool_name", tool.Name()).
             Msg("Including tool in list")
 
@@ -399,64 +704,103 @@ func (h *Handler) handleToolsList(w http.ResponseWriter, req *jsonrpc.Request, c
         tools = append(tools, toolDef)
     }
 
-    // Create the response according to MCP specification
-    response := map[string]any{
-        "jsonrpc": "2.0",
-        "id":      req.ID,
-        "result": map[string]any{
-            "tools": tools,
-        },
-    }
+    h.log(ctx).Info().
+        Int("tool_count", len(tools)).
+        Msg("Built tools list")
 
-    h.logger.Debug().
-        Interface("response", response).
-        Msg("Sending tools/list response")
-
-    // Send the response as raw JSON
-    w.Header().Set("Content-Type", "application/json")
-    w.Header().Set("Access-Control-Allow-Origin", "*")
-    w.Header().Set("Cache-Control", "no-cache")
-    w.Header().Set("Connection", "keep-alive")
-    w.WriteHeader(http.StatusOK)
-    
-    enc := json.NewEncoder(w)
-    enc.SetIndent("", "  ")  // Pretty print for debugging
-    if err := enc.Encode(response); err != nil {
-        h.logger.Error().Err(err).Msg("Failed to write tools/list response")
-        return
+    // Create the result according to MCP specification
+    result := map[string]any{
+        "tools": tools,
+    }
+    if nextCursor != "" {
+        result["nextCursor"] = nextCursor
     }
+    return result, nil
+}
 
-    h.logger.Info().
-        Int("tool_count", len(tools)).
-        Msg("Successfully sent tools list")
+// encodeCursor returns the opaque pagination cursor for the tool name.
+func encodeCursor(name string) string {
+    return base64.RawURLEncoding.EncodeToString([]byte(name))
 }
-// handleRequest handles a single JSON-RPC request.
-func (h *Handler) handleRequest(w http.ResponseWriter, flusher http.Flusher, req *jsonrpc.Request, ctx context.Context) {
-	h.logger.Info().
+
+// decodeCursor returns the tool name a cursor from encodeCursor names.
+func decodeCursor(cursor string) (string, error) {
+    name, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return "", err
+    }
+    return string(name), nil
+}
+
+// dispatch routes a JSON-RPC request to its method handler and builds the response.
+func (h *Handler) dispatch(ctx context.Context, req *jsonrpc.Request) *jsonrpc.Response {
+	h.inFlight.Add(1)
+	defer h.inFlight.Add(-1)
+
+	h.log(ctx).Info().
 		Str("method", req.Method).
 		Interface("id", req.ID).
-		Msg("Handling JSON-RPC request")
+		Msg("Dispatching JSON-RPC request")
+
+	var result any
+	var rpcErr *jsonrpc.Error
 
 	// Handle different methods
 	switch req.Method {
 	case "initialize":
-		h.handleInitialize(w, flusher, req, ctx)
-	case "tools/execute":
-	case "tools/call":
-		h.handleToolExecution(w, flusher, req, ctx)
+		result, rpcErr = h.handleInitialize(ctx, req)
+	case "tools/list":
+		result, rpcErr = h.handleToolsList(ctx, req)
+	case "tools/execute", "tools/call":
+		result, rpcErr = h.handleToolExecution(ctx, req)
+	case "logging/setLevel":
+		result, rpcErr = h.handleSetLevel(ctx, req)
+	case "completion/complete":
+		result, rpcErr = h.handleComplete(ctx, req)
+	case "metrics/subscribe", "metrics/unsubscribe":
+		result, rpcErr = h.handleMetricsSubscription(ctx, req)
 	default:
-		h.sendError(w, flusher, jsonrpc.NewError(
+		rpcErr = jsonrpc.NewTypedError(
 			jsonrpc.MethodNotFound,
 			fmt.Sprintf("Method not found: %s", req.Method),
-			nil,
-		))
+			jsonrpc.ErrorTypeNotFound,
+			map[string]any{"method": req.Method},
+		)
+	}
+
+	resp := &jsonrpc.Response{
+		JSONRPC: jsonrpc.Version,
+		ID:      req.ID,
 	}
+	if rpcErr != nil {
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
 }
 
+// withWeatherCredentials copies the weather API URL and key from the HTTP
+// request headers onto ctx. Other transports put them on the context up
+// front, in which case ctx is returned unchanged.
+func withWeatherCredentials(ctx context.Context) (context.Context, string, string) {
+	var apiURL, apiKey string
+	if httpReq, ok := GetRequestFromContext(ctx); ok && httpReq != nil {
+		apiURL = httpReq.Header.Get("X-Weather-API-URL")
+		apiKey = httpReq.Header.Get("X-Weather-API-Key")
+	}
 
+	if apiURL != "" {
+		ctx = context.WithValue(ctx, weather.ContextKeyAPIURL, apiURL)
+	}
+	if apiKey != "" {
+		ctx = context.WithValue(ctx, weather.ContextKeyAPIKey, apiKey)
+	}
+	return ctx, apiURL, apiKey
+}
 
 // handleToolExecution handles tool execution requests.
-func (h *Handler) handleToolExecution(w http.ResponseWriter, flusher http.Flusher, req *jsonrpc.Request, ctx context.Context) {
+func (h *Handler) handleToolExecution(ctx context.Context, req *jsonrpc.Request) (any, *jsonrpc.Error) {
 	// Parse tool execution parameters
 	var params struct {
 		Name      string          `json:"name"`
@@ -464,72 +808,105 @@ func (h *Handler) handleToolExecution(w http.ResponseWriter, flusher http.Flushe
 	}
 
 	if err := json.Unmarshal(req.Params, &params); err != nil {
-		h.sendError(w, flusher, jsonrpc.NewError(
+		return nil, jsonrpc.NewTypedError(
 			jsonrpc.InvalidParams,
 			"Invalid parameters",
+			jsonrpc.ErrorTypeValidation,
 			err.Error(),
-		))
-		return
+		)
 	}
 
-	// Get the HTTP request from the context
-	httpReq, ok := GetRequestFromContext(ctx)
-	if !ok {
-		h.sendError(w, flusher, jsonrpc.NewError(
-			jsonrpc.InternalError,
-			"Failed to get HTTP request from context",
-			nil,
-		))
-		return
+	// A missing or null arguments field means "no arguments", so the tool
+	// reports missing required fields instead of failing to parse
+	if len(params.Arguments) == 0 || string(params.Arguments) == "null" {
+		params.Arguments = json.RawMessage("{}")
 	}
 
-	// Get API key and URL from headers
-	apiURL := httpReq.Header.Get("X-Weather-API-URL")
-	apiKey := httpReq.Header.Get("X-Weather-API-Key")
+	ctx, apiURL, apiKey := withWeatherCredentials(ctx)
 
-	// Add API key and URL to the context
-	if apiURL != "" {
-		ctx = context.WithValue(ctx, weather.ContextKeyAPIURL, apiURL)
-	}
-	if apiKey != "" {
-		ctx = context.WithValue(ctx, weather.ContextKeyAPIKey, apiKey)
-	}
-
-	h.logger.Info().
+	// The API key is a credential, so only whether one was sent is logged
+	h.log(ctx).Info().
 		Str("tool_name", params.Name).
 		Interface("arguments", params.Arguments).
 		Interface("api_url", apiURL).
-		Interface("api_key", apiKey).
+		Bool("api_key_set", apiKey != "").
 		Msg("Executing tool")
 
 
 	// Execute the tool with the context
+	start := time.Now()
 	result, err := h.toolRegistry.Call(ctx, params.Name, params.Arguments)
+	h.recordAudit(ctx, params.Name, params.Arguments, start, err)
 	if err != nil {
-		h.logger.Error().
+		h.log(ctx).Error().
 			Err(err).
 			Str("tool_name", params.Name).
 			Msg("Tool execution failed")
+		h.notifyLog(ctx, logLevelError, map[string]any{
+			"message": "Tool execution failed",
+			"tool":    params.Name,
+			"error":   err.Error(),
+		})
+
+		// A request that ran out of time is reported as such, not as a tool failure
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, jsonrpc.NewTimeoutError()
+		}
+
+		// Unknown tools and rejected arguments are protocol errors in MCP
+		var toolErr *tools.Error
+		if errors.As(err, &toolErr) {
+			switch toolErr.Code {
+			case tools.ErrCodeToolNotFound:
+				return nil, jsonrpc.NewTypedError(
+					jsonrpc.InvalidParams,
+					fmt.Sprintf("Unknown tool: %s", params.Name),
+					jsonrpc.ErrorTypeNotFound,
+					map[string]any{"tool": params.Name},
+				)
+			case tools.ErrCodeInvalidArguments:
+				return nil, jsonrpc.NewTypedError(
+					jsonrpc.InvalidParams,
+					"Invalid tool arguments",
+					jsonrpc.ErrorTypeValidation,
+					toolErr.Message,
+				)
+			case tools.ErrCodeResultTooLarge:
+				// The oversized result is never sent on to the client
+				return nil, jsonrpc.NewTypedError(
+					jsonrpc.InternalError,
+					"Tool result too large",
+					jsonrpc.ErrorTypeTool,
+					toolErr.Message,
+				)
+			}
+		}
 
 		// For MCP, tool errors should be returned in the result object, not as protocol errors
-		// This allows the client to handle the error appropriately
+		// This allows the client to handle the error appropriately. The structured error
+		// data travels in _meta so clients get the same shape as for protocol errors.
 		errResult := map[string]any{
 			"isError": true,
-			"content": []map[string]any{
-				{
-					"type":  "text",
-					"text":  err.Error(),
+			"content": []tools.Content{tools.TextContent(err.Error())},
+			"_meta": map[string]any{
+				"error": &jsonrpc.ErrorData{
+					Type:      jsonrpc.ErrorTypeTool,
+					Details:   err.Error(),
+					Retryable: tools.IsRetryable(err),
 				},
 			},
 		}
 
-		// Send the error as a successful response with error details in the result
-		h.sendResponse(w, flusher, req.ID, errResult)
-		return
+		// Return the error as a successful response with error details in the result
+		return errResult, nil
 	}
 
-	// Send success response
-	h.sendResponse(w, flusher, req.ID, result)
+	h.notifyLog(ctx, logLevelInfo, map[string]any{
+		"message":     "Tool executed",
+		"tool":        params.Name,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	return result, nil
 }
 
 // handleNotification processes JSON-RPC notifications.
@@ -544,35 +921,9 @@ func (h *Handler) handleNotification(notif *jsonrpc.Notification) {
 	}
 }
 
-// sendResponse sends a JSON-RPC response.
-func (h *Handler) sendResponse(w http.ResponseWriter, flusher http.Flusher, id interface{}, result interface{}) {
-	resp := &jsonrpc.Response{
-		JSONRPC: jsonrpc.Version,
-		ID:      id,
-		Result:  result,
-	}
-	if err := h.sendJSON(w, flusher, resp); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to send response")
-	}
-}
-
-// sendError sends a JSON-RPC error response.
-func (h *Handler) sendError(w http.ResponseWriter, flusher http.Flusher, err *jsonrpc.Error) {
-	resp := &jsonrpc.Response{
-		JSONRPC: jsonrpc.Version,
-		Error:   err,
-	}
-	if sendErr := h.sendJSONResponse(w, flusher, resp, "JSON-RPC error response"); sendErr != nil {
-		h.logger.Error().Err(sendErr).Msg("Failed to send error response")
-	}
-}
-
-// sendJSON sends a JSON response as an SSE message
-func (h *Handler) sendJSON(w http.ResponseWriter, flusher http.Flusher, v interface{}) error {
-	return h.sendJSONResponse(w, flusher, v, "SSE message")
-}
-
-// sendJSONResponse sends a JSON-RPC response, handling both direct HTTP and SSE responses
+// sendJSONResponse sends a JSON-RPC response, handling both direct HTTP and SSE responses.
+// It is the single place responses are framed: a non-nil flusher means the
+// client accepted text/event-stream and gets an SSE event, otherwise plain JSON.
 func (h *Handler) sendJSONResponse(w http.ResponseWriter, flusher http.Flusher, response interface{}, responseType string) error {
 	jsonData, err := json.Marshal(response)
 	if err != nil {
@@ -584,11 +935,15 @@ func (h *Handler) sendJSONResponse(w http.ResponseWriter, flusher http.Flusher,
 		Str("response", string(jsonData)).
 		Msg(fmt.Sprintf("Sending %s", responseType))
 
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable buffering for Nginx
+
 	if flusher != nil {
 		// For SSE, send as a properly formatted event
 		// Format: "data: {json}\nid: {id}\n\n"
 		// Use a unique ID for each message (using timestamp for simplicity)
 		id := time.Now().UnixNano()
+		w.Header().Set("Content-Type", "text/event-stream")
 		_, err = fmt.Fprintf(w, "data: %s\nid: %d\n\n", jsonData, id)
 		if err != nil {
 			h.logger.Error().Err(err).Msg("Failed to write SSE message")
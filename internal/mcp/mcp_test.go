@@ -0,0 +1,604 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+	"mcp-sse-go/pkg/client"
+)
+
+// echoTool returns its text argument as a text content block.
+type echoTool struct {
+	*tools.DefaultTool
+}
+
+func newEchoTool() *echoTool {
+	return &echoTool{tools.NewDefaultTool("echo", "Echoes its text argument")}
+}
+
+func (t *echoTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	var params struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: err.Error()}
+	}
+	return json.Marshal(tools.Result{Content: []tools.Content{tools.TextContent(params.Text)}})
+}
+
+func (t *echoTool) GetToolDefinition() map[string]any {
+	def := t.DefaultTool.GetToolDefinition()
+	def["inputSchema"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"text": map[string]any{"type": "string"},
+		},
+		"required": []string{"text"},
+	}
+	return def
+}
+
+// newTestHandler returns a quiet handler serving the echo tool.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	registry := tools.NewRegistry()
+	registry.Register(newEchoTool())
+	h := NewHandler(registry)
+	h.SetLogger(zerolog.Nop())
+	return h
+}
+
+// sseEvent is one event read from an SSE stream.
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEEvent reads the next event from r, skipping comments.
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read SSE event: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if e.event != "" || e.data != "" {
+				return e
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// newTestServer starts an httptest server that is closed when the test
+// ends. Registered before any stream is opened, its Close runs after the
+// streams' cleanups have cancelled them.
+func newTestServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// openSSE opens the legacy SSE stream on srv and returns its reader.
+func openSSE(t *testing.T, srv *httptest.Server) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/sse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestSSEEndpointEventComesFirst(t *testing.T) {
+	h := newTestHandler(t)
+	srv := newTestServer(t, http.HandlerFunc(h.Handle))
+
+	stream := openSSE(t, srv)
+	e := readSSEEvent(t, stream)
+	if e.event != "endpoint" {
+		t.Fatalf("first event = %q, want endpoint", e.event)
+	}
+	if !strings.HasPrefix(e.data, "/sse?sessionId=") {
+		t.Fatalf("endpoint = %q, want /sse?sessionId=...", e.data)
+	}
+	if _, ok := h.sessions.get(strings.TrimPrefix(e.data, "/sse?sessionId=")); !ok {
+		t.Fatalf("endpoint %q names no open session", e.data)
+	}
+}
+
+// dialSSE connects a client to the legacy SSE transport on srv. The client
+// is closed when the test ends.
+func dialSSE(t *testing.T, srv *httptest.Server) *client.Client {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, err := client.Dial(ctx, srv.URL+"/sse")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSSERoundTrip(t *testing.T) {
+	h := newTestHandler(t)
+	srv := newTestServer(t, http.HandlerFunc(h.Handle))
+	c := dialSSE(t, srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	init, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if info, _ := init["serverInfo"].(map[string]any); info["name"] != "mcp-sse-go" {
+		t.Fatalf("initialize = %v, want the server's info", init)
+	}
+
+	defs, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(defs) != 1 || defs[0]["name"] != "echo" {
+		t.Fatalf("tools = %v, want only echo", defs)
+	}
+
+	result, err := c.CallTool(ctx, "echo", map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hi" {
+		t.Fatalf("result = %+v, want the echoed text", result)
+	}
+
+	// Protocol errors come back on the stream too
+	_, err = c.CallTool(ctx, "missing", nil)
+	var rpcErr *client.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != int(jsonrpc.InvalidParams) {
+		t.Fatalf("error = %v, want invalid params for an unknown tool", err)
+	}
+}
+
+func TestSSEPostFraming(t *testing.T) {
+	h := newTestHandler(t)
+
+	// Framed as on /mcp: JSON whenever the client takes it
+	for accept, want := range map[string]string{
+		"":                                    "application/json",
+		"application/json":                    "application/json",
+		"application/json, text/event-stream": "application/json",
+		"text/event-stream":                   "text/event-stream",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/sse", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.Handle(rec, req)
+		if ct := rec.Header().Get("Content-Type"); ct != want {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", accept, ct, want)
+		}
+		if !strings.Contains(rec.Body.String(), `"serverInfo"`) {
+			t.Errorf("Accept %q: body = %s, want the initialize result", accept, rec.Body)
+		}
+	}
+}
+
+func TestSSESessionClosedWithStream(t *testing.T) {
+	h := newTestHandler(t)
+	srv := newTestServer(t, http.HandlerFunc(h.Handle))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	readSSEEvent(t, bufio.NewReader(resp.Body))
+	if n := h.sessions.count(); n != 1 {
+		t.Fatalf("open sessions = %d, want 1", n)
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.sessions.count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("session still open after the stream closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// brokenWriter is a stream whose client vanishes after the first writes
+// reach it: every write after the first ok fails.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	ok int
+}
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	if w.ok == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.ok--
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestSSEBrokenStreamCleanedUp(t *testing.T) {
+	var logs bytes.Buffer
+	h := newTestHandler(t)
+	h.SetLogger(zerolog.New(&logs))
+	opened := make(chan string, 1)
+	h.sessions.observe = func(event, id string) {
+		if event == SessionCreated {
+			opened <- id
+		}
+	}
+
+	// Only the endpoint event gets through
+	w := &brokenWriter{ResponseRecorder: httptest.NewRecorder(), ok: 1}
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Handle(w, req)
+	}()
+
+	var id string
+	select {
+	case id = <-opened:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no session opened")
+	}
+	sess, ok := h.sessions.get(id)
+	if !ok {
+		t.Fatalf("session %s not registered", id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !sess.send(ctx, []byte(`{"jsonrpc":"2.0","method":"ping"}`)) {
+		t.Fatal("failed to queue a message")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream still open after a failed write")
+	}
+	if n := h.sessions.count(); n != 0 {
+		t.Errorf("open sessions = %d, want the broken one removed", n)
+	}
+	if n := h.Metrics().BrokenStreams; n != 1 {
+		t.Errorf("brokenStreams = %d, want 1", n)
+	}
+	for _, msg := range []string{`"message":"SSE stream broken"`, `"writing":"message"`, `"message":"Cleaned up SSE session"`} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("logs have no %s:\n%s", msg, logs.String())
+		}
+	}
+}
+
+func TestSSEPostGivesUpWhenOutOfTime(t *testing.T) {
+	h := newTestHandler(t)
+	sess, err := h.sessions.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No stream is draining the session, so once its queue is full a
+	// response can only wait
+	for sess.trySend([]byte(`{}`)) {
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	req := httptest.NewRequest(http.MethodPost, "/sse?sessionId="+sess.id, strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Handle(rec, req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("POST still blocked after its deadline")
+	}
+	// Nothing is written, so the request timeout middleware can answer
+	if rec.Body.Len() != 0 {
+		t.Fatalf("body = %q, want nothing written", rec.Body)
+	}
+}
+
+// listTools returns the tool definitions h reports in tools/list.
+func listTools(t *testing.T, h *Handler) []map[string]any {
+	t.Helper()
+
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	var resp struct {
+		Result struct {
+			Tools []map[string]any `json:"tools"`
+		} `json:"result"`
+	}
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, &resp)
+	return resp.Result.Tools
+}
+
+// findTool returns the definition of the named tool in defs.
+func findTool(t *testing.T, defs []map[string]any, name string) map[string]any {
+	t.Helper()
+
+	for _, def := range defs {
+		if def["name"] == name {
+			return def
+		}
+	}
+	t.Fatalf("tools/list has no %s tool", name)
+	return nil
+}
+
+func TestToolsListAnnotationHints(t *testing.T) {
+	h := newTestHandler(t)
+	lookup := tools.NewDefaultTool("lookup", "Looks things up")
+	lookup.SetReadOnlyHint(true)
+	lookup.SetIdempotentHint(true)
+	remove := tools.NewDefaultTool("remove", "Removes things")
+	remove.SetDestructiveHint(true)
+	remove.SetOpenWorldHint(false)
+	h.toolRegistry.Register(lookup)
+	h.toolRegistry.Register(remove)
+
+	defs := listTools(t, h)
+	tests := []struct {
+		tool string
+		want map[string]any
+	}{
+		{tool: "lookup", want: map[string]any{"readOnlyHint": true, "idempotentHint": true, "openWorldHint": true}},
+		{tool: "remove", want: map[string]any{"destructiveHint": true, "openWorldHint": false}},
+	}
+	for _, tt := range tests {
+		annotations, _ := findTool(t, defs, tt.tool)["annotations"].(map[string]any)
+		for _, hint := range []string{"readOnlyHint", "destructiveHint", "idempotentHint", "openWorldHint"} {
+			if got, want := annotations[hint], tt.want[hint]; got != want {
+				t.Errorf("%s: %s = %v, want %v", tt.tool, hint, got, want)
+			}
+		}
+	}
+}
+
+func TestToolsListTitleAndDescription(t *testing.T) {
+	h := newTestHandler(t)
+	forecast := tools.NewDefaultTool("forecast", "Forecasts")
+	forecast.SetTitle("Weather Forecast")
+	forecast.SetDescription("Gets the forecast for a city")
+	h.toolRegistry.Register(forecast)
+
+	defs := listTools(t, h)
+	tests := []struct {
+		tool, title, description string
+	}{
+		{tool: "forecast", title: "Weather Forecast", description: "Gets the forecast for a city"},
+		// Without a title one is derived from the name
+		{tool: "echo", title: "echo Tool", description: "Echoes its text argument"},
+	}
+	for _, tt := range tests {
+		def := findTool(t, defs, tt.tool)
+		annotations, _ := def["annotations"].(map[string]any)
+		if annotations["title"] != tt.title || def["description"] != tt.description {
+			t.Errorf("%s: title %v, description %v; want %q, %q", tt.tool, annotations["title"], def["description"], tt.title, tt.description)
+		}
+	}
+}
+
+// requiredTextTool is an echo tool that rejects calls without text and
+// records the arguments it was called with.
+type requiredTextTool struct {
+	*tools.DefaultTool
+	args []string
+}
+
+func (t *requiredTextTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	t.args = append(t.args, string(args))
+	var params struct {
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: err.Error()}
+	}
+	if params.Text == nil {
+		return nil, &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: "text is required"}
+	}
+	return json.Marshal(tools.Result{Content: []tools.Content{tools.TextContent(*params.Text)}})
+}
+
+func TestToolCallWithoutArguments(t *testing.T) {
+	h := newTestHandler(t)
+	tool := &requiredTextTool{DefaultTool: tools.NewDefaultTool("strict", "Requires text")}
+	h.toolRegistry.Register(tool)
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	for _, params := range []string{
+		`{"name":"strict"}`,
+		`{"name":"strict","arguments":null}`,
+	} {
+		var resp rpcResponse
+		memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":`+params+`}`, &resp)
+		if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidParams {
+			t.Fatalf("%s: error = %+v, want invalid params", params, resp.Error)
+		}
+		raw, err := json.Marshal(resp.Error.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(raw), `"details":"text is required"`) {
+			t.Fatalf("%s: error data = %s, want the required-field message", params, raw)
+		}
+	}
+	// The tool saw an empty object both times, never a missing or null value
+	if got := strings.Join(tool.args, " "); got != "{} {}" {
+		t.Fatalf("tool arguments = %s, want {} {}", got)
+	}
+}
+
+func TestToolsListOutputSchema(t *testing.T) {
+	h := newTestHandler(t)
+	reading := tools.NewDefaultTool("reading", "Reads a sensor")
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"celsius": map[string]any{"type": "number"}},
+	}
+	reading.SetOutputSchema(schema)
+	h.toolRegistry.Register(reading)
+
+	defs := listTools(t, h)
+	got, ok := findTool(t, defs, "reading")["outputSchema"].(map[string]any)
+	if !ok || got["type"] != "object" || got["properties"] == nil {
+		t.Errorf("reading outputSchema = %v, want the declared schema", got)
+	}
+	if schema, ok := findTool(t, defs, "echo")["outputSchema"]; ok {
+		t.Errorf("echo outputSchema = %v, want none", schema)
+	}
+}
+
+func TestToolResultSizeLimit(t *testing.T) {
+	h := newTestHandler(t)
+	h.toolRegistry.SetMaxResultSize(256)
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	var resp rpcResponse
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"small"}}}`, &resp)
+	if resp.Error != nil {
+		t.Fatalf("small result: error = %+v", resp.Error)
+	}
+
+	resp = rpcResponse{}
+	big := strings.Repeat("x", 1024)
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"`+big+`"}}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.InternalError || resp.Error.Message != "Tool result too large" {
+		t.Fatalf("large result: error = %+v, want Tool result too large", resp.Error)
+	}
+	if strings.Contains(string(resp.Result), big) {
+		t.Fatal("the oversized result was sent")
+	}
+}
+
+func TestToolsListPagination(t *testing.T) {
+	h := newTestHandler(t)
+	for _, name := range []string{"forecast", "alerts", "radar", "tides"} {
+		h.toolRegistry.Register(tools.NewDefaultTool(name, "Reports "+name))
+	}
+
+	// Without a limit every tool is listed, sorted by name
+	var names []string
+	for _, def := range listTools(t, h) {
+		names = append(names, def["name"].(string))
+	}
+	if got, want := strings.Join(names, " "), "alerts echo forecast radar tides"; got != want {
+		t.Fatalf("tools/list = %s, want %s", got, want)
+	}
+
+	tr := h.NewMemoryTransport(context.Background())
+	defer tr.Close()
+
+	var paged []string
+	cursor := ""
+	for page := 1; ; page++ {
+		if page > 5 {
+			t.Fatalf("still paging after %d pages: %v", page-1, paged)
+		}
+		params := `{"limit":2}`
+		if cursor != "" {
+			params = `{"limit":2,"cursor":"` + cursor + `"}`
+		}
+		var resp struct {
+			Result struct {
+				Tools      []map[string]any `json:"tools"`
+				NextCursor string           `json:"nextCursor"`
+			} `json:"result"`
+			Error *jsonrpc.Error `json:"error"`
+		}
+		memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":`+params+`}`, &resp)
+		if resp.Error != nil {
+			t.Fatalf("page %d: error = %+v", page, resp.Error)
+		}
+		if len(resp.Result.Tools) > 2 {
+			t.Fatalf("page %d has %d tools, want at most 2", page, len(resp.Result.Tools))
+		}
+		for _, def := range resp.Result.Tools {
+			paged = append(paged, def["name"].(string))
+		}
+		if page == 1 {
+			// A tool sorting before the cursor doesn't shift later pages
+			h.toolRegistry.Register(tools.NewDefaultTool("aqi", "Reports air quality"))
+		}
+		if resp.Result.NextCursor == "" {
+			break
+		}
+		cursor = resp.Result.NextCursor
+	}
+	if got, want := strings.Join(paged, " "), "alerts echo forecast radar tides"; got != want {
+		t.Fatalf("paged tools = %s, want %s", got, want)
+	}
+
+	var resp rpcResponse
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{"cursor":"not base64!"}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidParams {
+		t.Fatalf("error = %+v, want invalid params for a bad cursor", resp.Error)
+	}
+}
@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrTransportClosed is returned by a MemoryTransport after it is closed.
+var ErrTransportClosed = errors.New("mcp: transport closed")
+
+// MemoryTransport connects a client to a Handler in the same process over
+// channels, with no HTTP or byte stream in between. Messages are handled one
+// at a time in the order they are sent, which makes it suited to
+// deterministic end-to-end protocol tests.
+type MemoryTransport struct {
+	requests  chan []byte
+	responses chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryTransport starts serving MCP over an in-memory transport. It runs
+// until Close is called or ctx is cancelled.
+func (h *Handler) NewMemoryTransport(ctx context.Context) *MemoryTransport {
+	t := &MemoryTransport{
+		requests:  make(chan []byte),
+		responses: make(chan []byte, 16),
+		done:      make(chan struct{}),
+	}
+	go h.serveMemory(ctx, t)
+	return t
+}
+
+// serveMemory handles messages sent on t until it is closed.
+func (h *Handler) serveMemory(ctx context.Context, t *MemoryTransport) {
+	for {
+		select {
+		case <-ctx.Done():
+			t.Close()
+			return
+		case <-t.done:
+			return
+		case msg := <-t.requests:
+			resp := h.handleMessage(ctx, msg)
+			if resp == nil {
+				continue
+			}
+
+			data, err := json.Marshal(resp)
+			if err != nil {
+				h.logger.Error().Err(err).Msg("Failed to marshal JSON response")
+				continue
+			}
+			select {
+			case t.responses <- data:
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
+
+// Send delivers one JSON-RPC message to the handler.
+func (t *MemoryTransport) Send(ctx context.Context, msg []byte) error {
+	select {
+	case t.requests <- msg:
+		return nil
+	case <-t.done:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive returns the next message from the handler. Responses arrive in
+// the order their requests were sent; notifications get none.
+func (t *MemoryTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-t.responses:
+		return msg, nil
+	case <-t.done:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the transport. It is safe to call more than once.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.done) })
+	return nil
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// memoryCall sends a request over tr and decodes the response into v.
+func memoryCall(t *testing.T, tr *MemoryTransport, request string, v any) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := tr.Send(ctx, []byte(request)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	data, err := tr.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("failed to decode %q: %v", data, err)
+	}
+}
+
+// newMemoryTransport serves a test handler over a MemoryTransport that is
+// closed when the test ends.
+func newMemoryTransport(t *testing.T) *MemoryTransport {
+	t.Helper()
+
+	tr := newTestHandler(t).NewMemoryTransport(context.Background())
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestMemoryTransportResponsesInOrder(t *testing.T) {
+	tr := newMemoryTransport(t)
+	ctx := context.Background()
+
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+	} {
+		if err := tr.Send(ctx, []byte(msg)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	// The notification gets no response, so the second one answers id 2
+	for _, want := range []string{"1", "2"} {
+		data, err := tr.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		var resp struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.ID) != want {
+			t.Fatalf("response id = %s, want %s", resp.ID, want)
+		}
+	}
+}
+
+func TestMemoryTransportParseError(t *testing.T) {
+	tr := newMemoryTransport(t)
+
+	var resp struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	memoryCall(t, tr, `{not json`, &resp)
+	if resp.Error == nil || resp.Error.Code != int(jsonrpc.ParseError) {
+		t.Fatalf("error = %+v, want a parse error", resp.Error)
+	}
+}
+
+func TestMemoryTransportClose(t *testing.T) {
+	tr := newMemoryTransport(t)
+	ctx := context.Background()
+
+	tr.Close()
+	tr.Close()
+	if err := tr.Send(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)); !errors.Is(err, ErrTransportClosed) {
+		t.Fatalf("Send after Close = %v, want ErrTransportClosed", err)
+	}
+	if _, err := tr.Receive(ctx); !errors.Is(err, ErrTransportClosed) {
+		t.Fatalf("Receive after Close = %v, want ErrTransportClosed", err)
+	}
+}
+
+func TestMemoryTransportStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tr := newTestHandler(t).NewMemoryTransport(ctx)
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := tr.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		if errors.Is(err, ErrTransportClosed) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("transport still open after its context was cancelled")
+		}
+		// A Send that raced the shutdown is answered; drain it
+		tr.Receive(context.Background())
+	}
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/version"
+)
+
+// MetricsSnapshot is the payload of a notifications/metrics message.
+type MetricsSnapshot struct {
+	ActiveSessions   int          `json:"activeSessions"`
+	InFlightRequests int64        `json:"inFlightRequests"`
+	BlockedClients   int64        `json:"blockedClients"`
+	BrokenStreams    int64        `json:"brokenStreams"`
+	BuildInfo        version.Info `json:"buildInfo"`
+	Timestamp        time.Time    `json:"timestamp"`
+}
+
+// Metrics returns the handler's current session and request counts, how
+// many times a client has been blocked for probing session ids, how many
+// streams broke mid-write and the build metadata of the running binary.
+func (h *Handler) Metrics() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		ActiveSessions:   h.sessions.count(),
+		InFlightRequests: h.inFlight.Load(),
+		BrokenStreams:    h.brokenStreams.Load(),
+		BuildInfo:        version.Get(),
+		Timestamp:        time.Now().UTC(),
+	}
+	if h.lookupLimiter != nil {
+		snapshot.BlockedClients = h.lookupLimiter.blocks.Load()
+	}
+	return snapshot
+}
+
+// RunMetricsNotifications pushes a notifications/metrics message each
+// interval, until ctx is done, to every session with an open SSE stream that
+// has subscribed with metrics/subscribe.
+// Delivery is best effort: a session whose buffer is full skips a snapshot.
+func (h *Handler) RunMetricsNotifications(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.broadcastMetrics()
+		}
+	}
+}
+
+// broadcastMetrics sends one metrics snapshot to all subscribed streaming
+// sessions.
+func (h *Handler) broadcastMetrics() {
+	params, err := json.Marshal(h.Metrics())
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal metrics snapshot")
+		return
+	}
+
+	msg, err := json.Marshal(&jsonrpc.Notification{
+		JSONRPC: jsonrpc.Version,
+		Method:  "notifications/metrics",
+		Params:  params,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal metrics notification")
+		return
+	}
+
+	for _, sess := range h.sessions.streaming() {
+		if !sess.metrics.Load() {
+			continue
+		}
+		if !sess.trySend(msg) {
+			h.logger.Debug().Str("session_id", sess.id).Msg("Dropped metrics notification")
+		}
+	}
+}
+
+// handleMetricsSubscription subscribes the calling session to
+// notifications/metrics, or unsubscribes it. Only sessions can subscribe, as
+// the notifications are sent on the session's stream.
+func (h *Handler) handleMetricsSubscription(ctx context.Context, req *jsonrpc.Request) (any, *jsonrpc.Error) {
+	sess, ok := h.contextSession(ctx)
+	if !ok {
+		return nil, jsonrpc.NewTypedError(
+			jsonrpc.InvalidRequest,
+			fmt.Sprintf("%s requires a session", req.Method),
+			jsonrpc.ErrorTypeValidation,
+			nil,
+		)
+	}
+
+	subscribe := req.Method == "metrics/subscribe"
+	sess.metrics.Store(subscribe)
+	h.log(ctx).Info().Str("session_id", sess.id).Bool("subscribed", subscribe).Msg("Set metrics subscription")
+	return map[string]any{}, nil
+}
@@ -0,0 +1,69 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/version"
+	"mcp-sse-go/pkg/client"
+)
+
+func TestMetricsNotificationsOnlyReachSubscribers(t *testing.T) {
+	h := newTestHandler(t)
+	srv := newTestServer(t, http.HandlerFunc(h.Handle))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	subscribed := dialSSE(t, srv)
+	if err := subscribed.Call(ctx, "metrics/subscribe", nil, nil); err != nil {
+		t.Fatalf("metrics/subscribe: %v", err)
+	}
+	unsubscribed := dialSSE(t, srv)
+
+	go h.RunMetricsNotifications(ctx, 20*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		var n client.Notification
+		select {
+		case n = <-subscribed.Notifications():
+		case <-ctx.Done():
+			t.Fatalf("no notification %d", i+1)
+		}
+		if n.Method != "notifications/metrics" {
+			t.Fatalf("notification %d = %s, want notifications/metrics", i+1, n.Method)
+		}
+		var snapshot MetricsSnapshot
+		if err := json.Unmarshal(n.Params, &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.ActiveSessions != 2 {
+			t.Fatalf("activeSessions = %d, want 2", snapshot.ActiveSessions)
+		}
+		if snapshot.BuildInfo != version.Get() {
+			t.Fatalf("buildInfo = %+v, want %+v", snapshot.BuildInfo, version.Get())
+		}
+	}
+
+	// Snapshots have gone out, yet the other session was sent none
+	if _, err := unsubscribed.ListTools(ctx); err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	select {
+	case n := <-unsubscribed.Notifications():
+		t.Fatalf("unsubscribed session got %s", n.Method)
+	default:
+	}
+}
+
+func TestMetricsSubscribeRequiresSession(t *testing.T) {
+	tr := newMemoryTransport(t)
+
+	var resp rpcResponse
+	memoryCall(t, tr, `{"jsonrpc":"2.0","id":1,"method":"metrics/subscribe"}`, &resp)
+	if resp.Error == nil {
+		t.Fatalf("result = %s, want an error without a session", resp.Result)
+	}
+}
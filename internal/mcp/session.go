@@ -0,0 +1,330 @@
+package mcp
+
+import (
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// session is a client connected over the SSE GET stream. Responses to POSTs
+// carrying the session id are delivered on the stream rather than in the
+// POST response body.
+type session struct {
+	id       string
+	messages chan []byte
+	done     chan struct{}
+
+	// streams counts the SSE streams currently reading messages
+	streams atomic.Int32
+
+	// requests limits how fast the session may send requests
+	requests tokenBucket
+
+	// events numbers the messages sent on the session's streams and keeps
+	// recent ones for Last-Event-ID replay
+	events eventLog
+
+	// lastActive is when the session was last used, in Unix nanoseconds
+	lastActive atomic.Int64
+
+	// logLevel is the least severe log notification the client wants, as
+	// an index into logLevels
+	logLevel atomic.Int32
+
+	// metrics is set while the client is subscribed to notifications/metrics
+	metrics atomic.Bool
+}
+
+// send queues a message for delivery on the session's stream. It reports
+// false if the stream has already been closed or ctx is done first.
+func (s *session) send(ctx context.Context, msg []byte) bool {
+	select {
+	case s.messages <- msg:
+		return true
+	case <-s.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// trySend queues a message without blocking, dropping it if the session's
+// buffer is full or the session is closed. It is meant for best-effort
+// server-initiated notifications.
+func (s *session) trySend(msg []byte) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.messages <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// sessionRegistry tracks the open SSE streams by session id.
+type sessionRegistry struct {
+	sessions map[string]*session
+	mu       sync.RWMutex
+
+	// observe, if set, is told about every session opened and closed
+	observe func(event, id string)
+
+	// replayWindow is how many sent messages each new session keeps
+	replayWindow int
+
+	// maxSessions bounds the number of open sessions; zero means no bound
+	maxSessions int
+
+	// expiries orders sessions by when they were last known to be active,
+	// so idle need not look at every session. Entries are refreshed lazily:
+	// get only updates lastActive, and idle re-queues a session it finds
+	// was used since its entry was pushed.
+	expiries expiryQueue
+}
+
+// expiry is a session's place in the expiry queue: the session id and its
+// last known activity, in Unix nanoseconds.
+type expiry struct {
+	id string
+	at int64
+}
+
+// expiryQueue is a min-heap of expiries, earliest first.
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at < q[j].at }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiry)) }
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Session lifecycle events passed to sessionRegistry.observe.
+const (
+	SessionCreated = "session.created"
+	SessionDeleted = "session.deleted"
+	SessionExpired = "session.expired"
+)
+
+// errTooManySessions is returned by open when maxSessions are already open.
+var errTooManySessions = errors.New("too many open sessions")
+
+// newSessionRegistry creates an empty session registry.
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{
+		sessions: make(map[string]*session),
+	}
+}
+
+// open creates and registers a new session.
+func (r *sessionRegistry) open() (*session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{
+		id:       id,
+		messages: make(chan []byte, 16),
+		done:     make(chan struct{}),
+	}
+	s.logLevel.Store(logLevelOff)
+	s.events.window = r.replayWindow
+	s.lastActive.Store(time.Now().UnixNano())
+
+	r.mu.Lock()
+	if r.maxSessions > 0 && len(r.sessions) >= r.maxSessions {
+		r.mu.Unlock()
+		return nil, errTooManySessions
+	}
+	r.sessions[id] = s
+	heap.Push(&r.expiries, expiry{id: id, at: s.lastActive.Load()})
+	r.mu.Unlock()
+
+	if r.observe != nil {
+		r.observe(SessionCreated, id)
+	}
+	return s, nil
+}
+
+// get returns the session with the given id, marking it as active.
+func (r *sessionRegistry) get(id string) (*session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, exists := r.sessions[id]
+	if exists {
+		s.lastActive.Store(time.Now().UnixNano())
+	}
+	return s, exists
+}
+
+// close removes the session and unblocks any pending sends.
+func (r *sessionRegistry) close(id string) {
+	r.remove(id, SessionDeleted)
+}
+
+// expire closes a session that went unused for too long. It differs from
+// close only in the event observers see.
+func (r *sessionRegistry) expire(id string) {
+	r.remove(id, SessionExpired)
+}
+
+// remove removes the session, unblocks any pending sends and reports event
+// to the observer.
+func (r *sessionRegistry) remove(id, event string) {
+	r.mu.Lock()
+	s, exists := r.sessions[id]
+	if exists {
+		close(s.done)
+		delete(r.sessions, id)
+	}
+	r.mu.Unlock()
+
+	if exists && r.observe != nil {
+		r.observe(event, id)
+	}
+}
+
+// count returns the number of open sessions.
+func (r *sessionRegistry) count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.sessions)
+}
+
+// streaming returns the sessions that currently have an SSE stream open.
+func (r *sessionRegistry) streaming() []*session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		if s.streams.Load() > 0 {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// idle returns the sessions unused since before cutoff. Sessions with an
+// open stream are in use however long ago their last request was. Only the
+// sessions queued as last active before cutoff are looked at; those found
+// to be in use are queued again.
+func (r *sessionRegistry) idle(cutoff time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids, busy []string
+	for r.expiries.Len() > 0 && r.expiries[0].at < cutoff.UnixNano() {
+		e := heap.Pop(&r.expiries).(expiry)
+		s, exists := r.sessions[e.id]
+		if !exists {
+			continue
+		}
+		if s.streams.Load() == 0 && s.lastActive.Load() < cutoff.UnixNano() {
+			ids = append(ids, e.id)
+			continue
+		}
+		busy = append(busy, e.id)
+	}
+
+	// A streaming session may not have been used for longer than the
+	// timeout; it is checked again once its stream may have closed.
+	now := time.Now().UnixNano()
+	for _, id := range busy {
+		at := r.sessions[id].lastActive.Load()
+		if at < cutoff.UnixNano() {
+			at = now
+		}
+		heap.Push(&r.expiries, expiry{id: id, at: at})
+	}
+	return ids
+}
+
+// SetMaxSessions bounds how many sessions may be open at once. Beyond it,
+// new sessions are refused with 503 Service Unavailable. Zero or less
+// removes the bound. It must be called before the handler serves requests.
+func (h *Handler) SetMaxSessions(n int) {
+	h.sessions.maxSessions = n
+}
+
+// SetSessionSweepJitter delays each idle-session sweep by a random extra of
+// up to jitter, so servers started together don't sweep in lockstep. It
+// must be called before ExpireIdleSessions.
+func (h *Handler) SetSessionSweepJitter(jitter time.Duration) {
+	h.sweepJitter = jitter
+}
+
+// ExpireIdleSessions closes sessions that have gone unused for timeout,
+// checking periodically until ctx is done. Sessions with an open stream
+// never expire.
+func (h *Handler) ExpireIdleSessions(ctx context.Context, timeout time.Duration) {
+	interval := timeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	timer := time.NewTimer(jittered(interval, h.sweepJitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			for _, id := range h.sessions.idle(time.Now().Add(-timeout)) {
+				h.sessions.expire(id)
+				h.logger.Info().Str("session_id", id).Msg("Closed idle session")
+			}
+			timer.Reset(jittered(interval, h.sweepJitter))
+		}
+	}
+}
+
+// jittered returns interval plus a random extra of up to jitter.
+func jittered(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + mathrand.N(jitter+1)
+}
+
+// sessionOpenFailed answers a request whose session could not be opened:
+// 503 with Retry-After when the session limit is reached, 500 otherwise.
+func (h *Handler) sessionOpenFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errTooManySessions) {
+		h.log(r.Context()).Warn().Msg("Session limit reached")
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many sessions", http.StatusServiceUnavailable)
+		return
+	}
+	h.log(r.Context()).Error().Err(err).Msg("Failed to create session")
+	http.Error(w, "Failed to create session", http.StatusInternalServerError)
+}
+
+// newSessionID returns a random 128-bit hex session id.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitteredInterval(t *testing.T) {
+	const interval, jitter = time.Minute, 10 * time.Second
+
+	if got := jittered(interval, 0); got != interval {
+		t.Fatalf("without jitter: interval = %v, want %v", got, interval)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got := jittered(interval, jitter)
+		if got < interval || got > interval+jitter {
+			t.Fatalf("interval = %v, want between %v and %v", got, interval, interval+jitter)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("1000 intervals took %d distinct values, want them to vary", len(seen))
+	}
+}
+
+func TestIdleSessionsRequeued(t *testing.T) {
+	r := newSessionRegistry()
+	s, err := r.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A session used since it was queued is not idle, but is queued again
+	// and found once it stops being used
+	cutoff := time.Now().Add(time.Minute)
+	s.lastActive.Store(cutoff.Add(time.Second).UnixNano())
+	if got := r.idle(cutoff); len(got) != 0 {
+		t.Fatalf("idle sessions = %v, want none", got)
+	}
+	if got := r.idle(cutoff.Add(time.Minute)); len(got) != 1 || got[0] != s.id {
+		t.Fatalf("idle sessions = %v, want only %s", got, s.id)
+	}
+
+	// Closed sessions are dropped from the queue
+	closed, _ := r.open()
+	r.close(closed.id)
+	if got := r.idle(cutoff.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("idle sessions = %v, want none", got)
+	}
+	if n := r.expiries.Len(); n != 0 {
+		t.Fatalf("expiry queue holds %d sessions, want 0", n)
+	}
+}
+
+// scanIdle finds idle sessions by looking at every open session, as idle
+// did before sessions were queued by expiry.
+func scanIdle(r *sessionRegistry, cutoff time.Time) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []string
+	for id, s := range r.sessions {
+		if s.streams.Load() == 0 && s.lastActive.Load() < cutoff.UnixNano() {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func BenchmarkIdleSessions(b *testing.B) {
+	r := newSessionRegistry()
+	for i := 0; i < 10000; i++ {
+		if _, err := r.open(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	cutoff := time.Now().Add(-time.Minute)
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scanIdle(r, cutoff)
+		}
+	})
+	b.Run("heap", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.idle(cutoff)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// maxMessageSize is the largest single JSON-RPC message the stdio and
+// WebSocket transports accept.
+const maxMessageSize = 4 << 20
+
+// ServeStdio serves MCP over newline-delimited JSON-RPC, reading requests
+// from r and writing one response per line to w. It returns when r reaches
+// EOF or ctx is cancelled. A read of r still blocked on cancellation is
+// abandoned rather than interrupted, so the reading goroutine lives until r
+// yields or is closed.
+func (h *Handler) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	h.logger.Info().Msg("Serving MCP over stdio")
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	// Reads happen on their own goroutine, so an idle r can't hold off ctx
+	lines := make(chan []byte)
+	var readErr error
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			line := bytes.Clone(scanner.Bytes())
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr = scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case l, ok := <-lines:
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if readErr != nil {
+					return fmt.Errorf("failed to read stdio message: %w", readErr)
+				}
+				h.logger.Info().Msg("Stdio input closed")
+				return nil
+			}
+			line = l
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		h.logger.Debug().
+			Str("body", string(line)).
+			Msg("Raw stdio message")
+
+		resp := h.handleMessage(ctx, line)
+		if resp == nil {
+			continue
+		}
+		if err := writeLine(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handleMessage processes one JSON-RPC message for transports that carry
+// messages without HTTP semantics. It returns nil for notifications, which
+// expect no response.
+func (h *Handler) handleMessage(ctx context.Context, data []byte) *jsonrpc.Response {
+	var req jsonrpc.Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode JSON-RPC request")
+		return &jsonrpc.Response{
+			JSONRPC: jsonrpc.Version,
+			Error:   jsonrpc.NewTypedError(jsonrpc.ParseError, "Parse error", jsonrpc.ErrorTypeParse, err.Error()),
+		}
+	}
+
+	// Notifications carry no id and expect no response
+	if req.ID == nil {
+		h.handleNotification(&jsonrpc.Notification{
+			JSONRPC: req.JSONRPC,
+			Method:  req.Method,
+			Params:  req.Params,
+		})
+		return nil
+	}
+
+	return h.dispatch(ctx, &req)
+}
+
+// writeLine writes v as a single line of JSON.
+func writeLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON response: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write stdio message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// stdioResponse is a JSON-RPC response as written by ServeStdio.
+type stdioResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// startStdio serves h over a pair of pipes, returning the writer for its
+// input and a reader for its output lines.
+func startStdio(t *testing.T, h *Handler) (io.WriteCloser, *bufio.Scanner) {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := h.ServeStdio(context.Background(), inR, outW)
+		outW.Close()
+		done <- err
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("ServeStdio returned %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("ServeStdio did not return after its input closed")
+		}
+	})
+	return inW, bufio.NewScanner(outR)
+}
+
+// stdioCall writes one line to in and decodes the next line from out.
+func stdioCall(t *testing.T, in io.Writer, out *bufio.Scanner, line string) stdioResponse {
+	t.Helper()
+
+	if _, err := io.WriteString(in, line+"\n"); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	if !out.Scan() {
+		t.Fatalf("no response to %s: %v", line, out.Err())
+	}
+	var resp stdioResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", out.Text(), err)
+	}
+	return resp
+}
+
+func TestStdioInitializeAndToolsList(t *testing.T) {
+	in, out := startStdio(t, newTestHandler(t))
+
+	resp := stdioCall(t, in, out, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	if resp.Error != nil || string(resp.ID) != "1" {
+		t.Fatalf("initialize response = %+v, want a result for id 1", resp)
+	}
+	var init struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		ServerInfo      map[string]any `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(resp.Result, &init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo["name"] != "mcp-sse-go" {
+		t.Fatalf("initialize result = %s", resp.Result)
+	}
+
+	// The notification gets no line of its own, so the next line read
+	// answers tools/list
+	if _, err := io.WriteString(in, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	resp = stdioCall(t, in, out, `{"jsonrpc":"2.0","id":"two","method":"tools/list"}`)
+	if string(resp.ID) != `"two"` {
+		t.Fatalf("tools/list id = %s, want \"two\"", resp.ID)
+	}
+	var list struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(resp.Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tools) != 1 || list.Tools[0].Name != "echo" {
+		t.Fatalf("tools/list result = %s, want the echo tool", resp.Result)
+	}
+}
+
+func TestStdioParseError(t *testing.T) {
+	in, out := startStdio(t, newTestHandler(t))
+
+	resp := stdioCall(t, in, out, `{not json`)
+	if resp.Error == nil || resp.Error.Code != int(jsonrpc.ParseError) {
+		t.Fatalf("response = %+v, want a parse error", resp)
+	}
+
+	// The loop keeps serving after a bad line
+	resp = stdioCall(t, in, out, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if resp.Error != nil {
+		t.Fatalf("tools/list after a bad line failed: %+v", resp.Error)
+	}
+}
+
+func TestStdioReturnsAtEOF(t *testing.T) {
+	h := newTestHandler(t)
+	var out strings.Builder
+	if err := h.ServeStdio(context.Background(), strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`+"\n"), &out); err != nil {
+		t.Fatalf("ServeStdio returned %v", err)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("output = %q, want one response line", out.String())
+	}
+}
+
+func TestStdioStopsWhenCancelled(t *testing.T) {
+	// Input that stays open and idle, as a terminal's stdin does
+	inR, inW := io.Pipe()
+	defer inW.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- newTestHandler(t).ServeStdio(ctx, inR, io.Discard)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("ServeStdio = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeStdio did not return after ctx was cancelled")
+	}
+}
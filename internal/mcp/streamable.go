@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+)
+
+// SessionIDHeader carries the session id on Streamable HTTP requests.
+const SessionIDHeader = "Mcp-Session-Id"
+
+// HandleStreamable serves the Streamable HTTP transport on a single endpoint.
+// POST carries JSON-RPC messages, GET opens a server-to-client SSE stream and
+// DELETE ends the session. The session id is assigned in the initialize
+// response and travels in the Mcp-Session-Id header afterwards.
+func (h *Handler) HandleStreamable(w http.ResponseWriter, r *http.Request) {
+	h.log(r.Context()).Info().
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Str("remote", r.RemoteAddr).
+		Str("session_id", h.RequestSessionID(r)).
+		Msg("Incoming streamable HTTP request")
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handleStreamablePost(w, r)
+	case http.MethodGet:
+		h.handleStreamableGet(w, r)
+	case http.MethodDelete:
+		h.handleStreamableDelete(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStreamablePost dispatches a single JSON-RPC message. The response is
+// a plain JSON body unless the client only accepts an event stream, in which
+// case it is sent as a one-event SSE stream.
+func (h *Handler) handleStreamablePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to read request body")
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var req jsonrpc.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to decode JSON-RPC request")
+		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	// An initialize without an id would get a session nobody is told about
+	if req.Method == "initialize" && req.ID == nil {
+		h.log(r.Context()).Warn().Msg("Rejected initialize sent as a notification")
+		writeJSONRPCError(w, http.StatusBadRequest, jsonrpc.NewTypedError(
+			jsonrpc.InvalidRequest,
+			"initialize must be a request with an id",
+			jsonrpc.ErrorTypeValidation,
+			nil,
+		))
+		return
+	}
+
+	// initialize starts a session; everything else must belong to one
+	ctx := WithRequest(r.Context(), r)
+	var newSession *session
+	if req.Method == "initialize" {
+		sess, err := h.sessions.open()
+		if err != nil {
+			h.sessionOpenFailed(w, r, err)
+			return
+		}
+		newSession = sess
+		w.Header().Set(SessionIDHeader, sess.id)
+		h.log(r.Context()).Info().Str("session_id", sess.id).Msg("Created streamable HTTP session")
+		ctx = WithSessionID(ctx, sess.id)
+	} else if h.RequestSessionID(r) == "" && h.allowsAnonymous(&req) {
+		h.log(r.Context()).Info().Str("method", req.Method).Msg("Allowing anonymous tool call")
+	} else if sess, ok := h.lookupStreamableSession(w, r); !ok {
+		return
+	} else if ok, retryAfter := h.allowSessionRequest(sess); !ok {
+		tooManyRequests(w, "Too many requests", retryAfter)
+		return
+	} else {
+		ctx = WithSessionID(ctx, sess.id)
+	}
+
+	// Notifications carry no id and expect no response
+	if req.ID == nil {
+		h.handleNotification(&jsonrpc.Notification{
+			JSONRPC: req.JSONRPC,
+			Method:  req.Method,
+			Params:  req.Params,
+		})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var flusher http.Flusher
+	if prefersEventStream(r) {
+		var ok bool
+		if flusher, ok = eventStreamFlusher(w); !ok {
+			return
+		}
+	}
+
+	resp := h.dispatch(ctx, &req)
+
+	// A rejected initialize doesn't get to keep its session
+	if newSession != nil && resp.Error != nil {
+		h.sessions.close(newSession.id)
+		w.Header().Del(SessionIDHeader)
+	}
+	if err := h.sendJSONResponse(w, flusher, resp, "JSON-RPC response"); err != nil {
+		h.log(r.Context()).Error().Err(err).Str("method", req.Method).Msg("Failed to send response")
+	}
+}
+
+// handleStreamableGet opens the server-to-client SSE stream for a session.
+func (h *Handler) handleStreamableGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "Client must accept text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	sess, ok := h.lookupStreamableSession(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := eventStreamFlusher(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	h.log(r.Context()).Info().Str("session_id", sess.id).Msg("Opened streamable HTTP stream")
+
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if err := h.replayEvents(w, flusher, sess, lastEventID); err != nil {
+			h.log(r.Context()).Error().Err(err).Msg("Failed to replay events")
+			return
+		}
+	}
+	h.streamSession(r.Context(), w, flusher, sess)
+}
+
+// handleStreamableDelete ends a session at the client's request.
+func (h *Handler) handleStreamableDelete(w http.ResponseWriter, r *http.Request) {
+	sess, ok := h.lookupStreamableSession(w, r)
+	if !ok {
+		return
+	}
+
+	h.sessions.close(sess.id)
+	h.log(r.Context()).Info().Str("session_id", sess.id).Msg("Closed streamable HTTP session")
+	w.WriteHeader(http.StatusOK)
+}
+
+// lookupStreamableSession resolves the session named by the Mcp-Session-Id
+// header, writing an error response and reporting false if there is none.
+func (h *Handler) lookupStreamableSession(w http.ResponseWriter, r *http.Request) (*session, bool) {
+	sessionID := h.RequestSessionID(r)
+	if sessionID == "" {
+		h.log(r.Context()).Warn().Msg("Request without a session")
+		writeJSONRPCError(w, http.StatusBadRequest, jsonrpc.NewTypedError(
+			jsonrpc.InvalidRequest,
+			"Missing "+SessionIDHeader+" header",
+			jsonrpc.ErrorTypeValidation,
+			nil,
+		))
+		return nil, false
+	}
+
+	return h.resolveSession(w, r, sessionID)
+}
+
+// SetSessionHeaderAliases accepts the session id from the named headers,
+// e.g. a legacy X-Session-Id, when Mcp-Session-Id is absent. Responses
+// always use Mcp-Session-Id.
+func (h *Handler) SetSessionHeaderAliases(names ...string) {
+	h.sessionHeaderAliases = names
+}
+
+// RequestSessionID returns the session id from the first session header
+// present on r, checking Mcp-Session-Id before any aliases.
+func (h *Handler) RequestSessionID(r *http.Request) string {
+	if id := r.Header.Get(SessionIDHeader); id != "" {
+		return id
+	}
+	for _, name := range h.sessionHeaderAliases {
+		if id := r.Header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// allowsAnonymous reports whether req is a call to a tool that may be used
+// without a session.
+func (h *Handler) allowsAnonymous(req *jsonrpc.Request) bool {
+	if req.Method != "tools/call" && req.Method != "tools/execute" {
+		return false
+	}
+
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return false
+	}
+
+	tool, exists := h.toolRegistry.Get(params.Name)
+	if !exists {
+		return false
+	}
+	anon, ok := tool.(tools.AnonymousCallable)
+	return ok && anon.AllowAnonymous()
+}
+
+// prefersEventStream reports whether a POST response should be sent as SSE:
+// the client accepts an event stream and did not also ask for plain JSON.
+// Spec-compliant clients accept both, and the spec leaves the choice to the
+// server. JSON wins because a POST's stream would only ever hold the one
+// response: log and other server-initiated notifications travel on the
+// session's GET stream.
+func prefersEventStream(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return acceptsEventStream(r) && !strings.Contains(accept, "application/json")
+}
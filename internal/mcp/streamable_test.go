@@ -0,0 +1,367 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/tools"
+)
+
+const initializeRequest = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`
+
+// postStreamable POSTs body to h's Streamable HTTP endpoint with the given
+// Accept header and session id, either of which may be empty.
+func postStreamable(t *testing.T, h *Handler, accept, sessionID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+	rec := httptest.NewRecorder()
+	h.HandleStreamable(rec, req)
+	return rec
+}
+
+// initializeStreamable opens a Streamable HTTP session and returns its id.
+func initializeStreamable(t *testing.T, h *Handler) string {
+	t.Helper()
+
+	rec := postStreamable(t, h, "application/json", "", initializeRequest)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("initialize status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	id := rec.Header().Get(SessionIDHeader)
+	if id == "" {
+		t.Fatal("initialize response has no " + SessionIDHeader)
+	}
+	return id
+}
+
+func TestStreamablePostReturnsJSON(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	rec := postStreamable(t, h, "application/json, text/event-stream", id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var resp struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body.String(), err)
+	}
+	if resp.ID != 2 || !strings.Contains(string(resp.Result), `"echo"`) {
+		t.Fatalf("response = %s, want id 2 listing echo", rec.Body.String())
+	}
+}
+
+func TestStreamablePostReturnsSSE(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	rec := postStreamable(t, h, "text/event-stream", id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	e := readSSEEvent(t, bufio.NewReader(rec.Body))
+	if !strings.Contains(e.data, `"id":2`) || !strings.Contains(e.data, `"echo"`) {
+		t.Fatalf("event data = %s, want id 2 listing echo", e.data)
+	}
+}
+
+func TestStreamableInitializeFraming(t *testing.T) {
+	h := newTestHandler(t)
+
+	// initialize is framed like any other method
+	rec := postStreamable(t, h, "application/json", "", initializeRequest)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("JSON: Content-Type = %q, want application/json", ct)
+	}
+	var resp rpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body.String(), err)
+	}
+	if !strings.Contains(string(resp.Result), `"serverInfo"`) {
+		t.Fatalf("JSON: result = %s, want serverInfo", resp.Result)
+	}
+
+	rec = postStreamable(t, h, "text/event-stream", "", initializeRequest)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("SSE: Content-Type = %q, want text/event-stream", ct)
+	}
+	e := readSSEEvent(t, bufio.NewReader(rec.Body))
+	if err := json.Unmarshal([]byte(e.data), &resp); err != nil {
+		t.Fatalf("failed to decode event data %q: %v", e.data, err)
+	}
+	if !strings.Contains(string(resp.Result), `"serverInfo"`) {
+		t.Fatalf("SSE: result = %s, want serverInfo", resp.Result)
+	}
+}
+
+func TestStreamablePostFraming(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	// JSON wins whenever the client takes it, including the spec's
+	// "application/json, text/event-stream"
+	for accept, want := range map[string]string{
+		"":                                    "application/json",
+		"application/json":                    "application/json",
+		"application/json, text/event-stream": "application/json",
+		"text/event-stream, application/json": "application/json",
+		"text/event-stream":                   "text/event-stream",
+	} {
+		rec := postStreamable(t, h, accept, id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		if ct := rec.Header().Get("Content-Type"); ct != want {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", accept, ct, want)
+		}
+	}
+}
+
+func TestStreamableInitializeNotificationRejected(t *testing.T) {
+	h := newTestHandler(t)
+
+	rec := postStreamable(t, h, "", "", `{"jsonrpc":"2.0","method":"initialize","params":{}}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec.Header().Get(SessionIDHeader) != "" {
+		t.Fatal("initialize notification was given a session id")
+	}
+	if n := h.sessions.count(); n != 0 {
+		t.Fatalf("open sessions = %d, want 0", n)
+	}
+	if !strings.Contains(rec.Body.String(), `"code":-32600`) {
+		t.Fatalf("body = %s, want an invalid request error", rec.Body)
+	}
+}
+
+func TestStreamableSessionRequired(t *testing.T) {
+	h := newTestHandler(t)
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+
+	rec := postStreamable(t, h, "", "", list)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("without a session: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	var resp rpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body, err)
+	}
+	if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidRequest {
+		t.Fatalf("without a session: error = %+v, want invalid request", resp.Error)
+	}
+	if raw, _ := json.Marshal(resp.Error.Data); !strings.Contains(string(raw), `"type":"validation_error"`) {
+		t.Fatalf("without a session: error data = %s, want a validation error", raw)
+	}
+	if rec := postStreamable(t, h, "", "unknown", list); rec.Code != http.StatusNotFound {
+		t.Fatalf("with an unknown session: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestUnknownSessionErrorData(t *testing.T) {
+	h := newTestHandler(t)
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+
+	sse := httptest.NewRequest(http.MethodPost, "/sse?sessionId=unknown", strings.NewReader(list))
+	sse.Header.Set("Content-Type", "application/json")
+	sseRec := httptest.NewRecorder()
+	h.Handle(sseRec, sse)
+
+	for transport, rec := range map[string]*httptest.ResponseRecorder{
+		"/sse": sseRec,
+		"/mcp": postStreamable(t, h, "", "unknown", list),
+	} {
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", transport, rec.Code, http.StatusNotFound)
+			continue
+		}
+		var resp rpcResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: failed to decode %q: %v", transport, rec.Body, err)
+			continue
+		}
+		if resp.Error == nil || resp.Error.Code != jsonrpc.InvalidRequest {
+			t.Errorf("%s: error = %+v, want invalid request", transport, resp.Error)
+			continue
+		}
+		raw, err := json.Marshal(resp.Error.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data jsonrpc.ErrorData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			t.Fatalf("%s: failed to decode error data %s: %v", transport, raw, err)
+		}
+		if data.Type != jsonrpc.ErrorTypeNotFound || !strings.Contains(string(raw), `"retryable":false`) || data.Details != "unknown" {
+			t.Errorf("%s: error data = %s, want a non-retryable not_found naming the session", transport, raw)
+		}
+	}
+}
+
+func TestStreamableAnonymousTool(t *testing.T) {
+	h := newTestHandler(t)
+	status := &echoTool{tools.NewDefaultTool("status", "Reports status")}
+	status.SetAllowAnonymous(true)
+	h.toolRegistry.Register(status)
+
+	call := func(name string) *httptest.ResponseRecorder {
+		return postStreamable(t, h, "", "", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+name+`","arguments":{"text":"ok"}}}`)
+	}
+
+	rec := call("status")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"text":"ok"`) {
+		t.Fatalf("anonymous tool: status %d, body %s; want the result", rec.Code, rec.Body)
+	}
+	if rec.Header().Get(SessionIDHeader) != "" || h.sessions.count() != 0 {
+		t.Fatal("anonymous call opened a session")
+	}
+	if rec := call("echo"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("other tool: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStreamableSessionHeaderAliases(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetSessionHeaderAliases("X-Session-Id")
+	id := initializeStreamable(t, h)
+
+	post := func(headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleStreamable(rec, req)
+		return rec.Code
+	}
+
+	if code := post(map[string]string{"X-Session-Id": id}); code != http.StatusOK {
+		t.Fatalf("alias header: status = %d, want %d", code, http.StatusOK)
+	}
+	// Only configured names are read
+	if code := post(map[string]string{"Session-Id": id}); code != http.StatusBadRequest {
+		t.Fatalf("unknown header: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	// The canonical header wins over an alias
+	if code := post(map[string]string{SessionIDHeader: id, "X-Session-Id": "stale"}); code != http.StatusOK {
+		t.Fatalf("both headers: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestStreamableNotificationAccepted(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	rec := postStreamable(t, h, "", id, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("body = %q, want none", rec.Body.String())
+	}
+}
+
+func TestStreamableRejectedInitializeKeepsNoSession(t *testing.T) {
+	h := newTestHandler(t)
+
+	rec := postStreamable(t, h, "", "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`)
+	if rec.Header().Get(SessionIDHeader) != "" {
+		t.Fatal("rejected initialize was given a session id")
+	}
+	if n := h.sessions.count(); n != 0 {
+		t.Fatalf("open sessions = %d, want 0", n)
+	}
+}
+
+func TestStreamableDelete(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	req := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+	req.Header.Set(SessionIDHeader, id)
+	rec := httptest.NewRecorder()
+	h.HandleStreamable(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = postStreamable(t, h, "", id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("after DELETE: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestStreamableMaxSessions(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetMaxSessions(1)
+	id := initializeStreamable(t, h)
+
+	rec := postStreamable(t, h, "", "", initializeRequest)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("503 response has no Retry-After")
+	}
+
+	// Ending a session makes room for another
+	h.sessions.close(id)
+	initializeStreamable(t, h)
+}
+
+func TestIdleSessionsExpire(t *testing.T) {
+	h := newTestHandler(t)
+	idle := initializeStreamable(t, h)
+	active := initializeStreamable(t, h)
+	streaming := initializeStreamable(t, h)
+
+	cutoff := time.Now()
+	for _, id := range []string{idle, active, streaming} {
+		s, _ := h.sessions.get(id)
+		s.lastActive.Store(cutoff.Add(-time.Minute).UnixNano())
+	}
+
+	// A request marks a session active; an open stream keeps it alive
+	if rec := postStreamable(t, h, "", active, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	s, _ := h.sessions.get(streaming)
+	s.lastActive.Store(cutoff.Add(-time.Minute).UnixNano())
+	s.streams.Add(1)
+
+	got := h.sessions.idle(cutoff)
+	if len(got) != 1 || got[0] != idle {
+		t.Fatalf("idle sessions = %v, want only %s", got, idle)
+	}
+}
+
+func TestStreamableGetRequiresEventStream(t *testing.T) {
+	h := newTestHandler(t)
+	id := initializeStreamable(t, h)
+
+	req := httptest.NewRequest(http.MethodGet, "/mcp", nil)
+	req.Header.Set(SessionIDHeader, id)
+	rec := httptest.NewRecorder()
+	h.HandleStreamable(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotAcceptable)
+	}
+}
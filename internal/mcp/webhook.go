@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// webhookQueueSize bounds the events waiting for delivery; further
+	// events are dropped so a slow receiver never blocks requests.
+	webhookQueueSize = 256
+	// webhookAttempts is how many times delivery of an event is tried.
+	webhookAttempts = 3
+	// webhookTimeout bounds a single delivery attempt.
+	webhookTimeout = 5 * time.Second
+)
+
+// SessionEvent is the JSON body POSTed to the session webhook.
+type SessionEvent struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	Time      time.Time `json:"time"`
+}
+
+// webhookNotifier delivers session events to a URL from a background
+// goroutine, retrying failed deliveries with backoff.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+	queue  chan SessionEvent
+	logger zerolog.Logger
+}
+
+// SetSessionWebhook POSTs a SessionEvent to url whenever a session is
+// created, deleted or expires for lack of use. Delivery happens in the background until ctx is
+// cancelled. It must be called before the handler serves requests.
+func (h *Handler) SetSessionWebhook(ctx context.Context, url string) {
+	n := &webhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan SessionEvent, webhookQueueSize),
+		logger: h.logger.With().Str("webhook_url", url).Logger(),
+	}
+	h.sessions.observe = n.enqueue
+	go n.run(ctx)
+}
+
+// enqueue queues an event without blocking, dropping it if the queue is full.
+func (n *webhookNotifier) enqueue(event, id string) {
+	select {
+	case n.queue <- SessionEvent{Type: event, SessionID: id, Time: time.Now()}:
+	default:
+		n.logger.Warn().Str("event", event).Str("session_id", id).Msg("Webhook queue full, dropping event")
+	}
+}
+
+// run delivers queued events until ctx is cancelled.
+func (n *webhookNotifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			n.deliver(ctx, event)
+		}
+	}
+}
+
+// deliver sends event, retrying with exponential backoff.
+func (n *webhookNotifier) deliver(ctx context.Context, event SessionEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error().Err(err).Msg("Failed to marshal webhook event")
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := n.post(ctx, body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			n.logger.Error().Err(err).Str("event", event.Type).Str("session_id", event.SessionID).Msg("Webhook delivery failed")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single delivery attempt.
+func (n *webhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
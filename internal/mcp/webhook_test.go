@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newWebhookReceiver returns a server that decodes each POSTed SessionEvent
+// onto the returned channel. The first failures requests are answered with
+// 500 and not recorded.
+func newWebhookReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan SessionEvent) {
+	t.Helper()
+
+	events := make(chan SessionEvent, 16)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event SessionEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode webhook body: %v", err)
+		}
+		events <- event
+	}))
+	t.Cleanup(srv.Close)
+	return srv, events
+}
+
+// nextEvent returns the next event the receiver got.
+func nextEvent(t *testing.T, events <-chan SessionEvent, timeout time.Duration) SessionEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(timeout):
+		t.Fatal("no webhook event received")
+		return SessionEvent{}
+	}
+}
+
+func TestSessionWebhookEvents(t *testing.T) {
+	h := newTestHandler(t)
+	srv, events := newWebhookReceiver(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.SetSessionWebhook(ctx, srv.URL)
+
+	id := initializeStreamable(t, h)
+	if e := nextEvent(t, events, 2*time.Second); e.Type != SessionCreated || e.SessionID != id || e.Time.IsZero() {
+		t.Fatalf("event = %+v, want %s for %s", e, SessionCreated, id)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/mcp", nil)
+	req.Header.Set(SessionIDHeader, id)
+	h.HandleStreamable(httptest.NewRecorder(), req)
+	if e := nextEvent(t, events, 2*time.Second); e.Type != SessionDeleted || e.SessionID != id {
+		t.Fatalf("event = %+v, want %s for %s", e, SessionDeleted, id)
+	}
+
+	// An idle session expires rather than being deleted
+	id = initializeStreamable(t, h)
+	nextEvent(t, events, 2*time.Second)
+	go h.ExpireIdleSessions(ctx, time.Millisecond)
+	if e := nextEvent(t, events, 3*time.Second); e.Type != SessionExpired || e.SessionID != id {
+		t.Fatalf("event = %+v, want %s for %s", e, SessionExpired, id)
+	}
+}
+
+func TestSessionWebhookRetriesFailedDelivery(t *testing.T) {
+	h := newTestHandler(t)
+	srv, events := newWebhookReceiver(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.SetSessionWebhook(ctx, srv.URL)
+
+	// The first attempt fails; the retry after a second's backoff lands
+	id := initializeStreamable(t, h)
+	if e := nextEvent(t, events, 3*time.Second); e.Type != SessionCreated || e.SessionID != id {
+		t.Fatalf("event = %+v, want %s for %s", e, SessionCreated, id)
+	}
+}
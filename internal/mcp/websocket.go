@@ -0,0 +1,199 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+const (
+	// wsWriteWait is how long a single WebSocket write may take.
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long to wait for a pong before dropping the peer.
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is how often pings are sent; it must be below wsPongWait.
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// CORS is open for every other transport, so accept any origin here too
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// HandleWebSocket upgrades the connection and exchanges JSON-RPC messages in
+// both directions, one message per text frame. Each connection is its own
+// session, so server-initiated notifications reach it the same way they
+// reach an SSE stream.
+func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error response
+		h.log(r.Context()).Error().Err(err).Msg("Failed to upgrade WebSocket connection")
+		return
+	}
+	defer conn.Close()
+
+	// Requests are dispatched concurrently so a slow tool call doesn't stall
+	// reads and pong handling; responses are matched by id. Deferred here so
+	// the session is closed first and pending sends can't block on it.
+	var pending sync.WaitGroup
+	defer pending.Wait()
+
+	sess, err := h.sessions.open()
+	if err != nil {
+		h.log(r.Context()).Error().Err(err).Msg("Failed to create session")
+		code, reason := websocket.CloseInternalServerErr, "failed to create session"
+		if errors.Is(err, errTooManySessions) {
+			code, reason = websocket.CloseTryAgainLater, "too many sessions"
+		}
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(wsWriteWait))
+		return
+	}
+	defer h.sessions.close(sess.id)
+
+	sess.streams.Add(1)
+	defer sess.streams.Add(-1)
+
+	h.log(r.Context()).Info().
+		Str("session_id", sess.id).
+		Str("remote", r.RemoteAddr).
+		Msg("Handling WebSocket connection")
+
+	// All writes happen on the writer goroutine, as the connection allows
+	// only one concurrent writer
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		h.writeWebSocket(conn, sess)
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	ctx := WithSessionID(WithRequest(r.Context(), r), sess.id)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.log(r.Context()).Info().Str("session_id", sess.id).Msg("WebSocket closed by client")
+			} else {
+				h.log(r.Context()).Warn().Err(err).Str("session_id", sess.id).Msg("WebSocket read failed")
+			}
+			return
+		}
+
+		select {
+		case <-writerDone:
+			return
+		default:
+		}
+
+		var req jsonrpc.Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			h.log(r.Context()).Error().Err(err).Msg("Failed to decode JSON-RPC request")
+			resp := &jsonrpc.Response{
+				JSONRPC: jsonrpc.Version,
+				Error:   jsonrpc.NewTypedError(jsonrpc.ParseError, "Parse error", jsonrpc.ErrorTypeParse, err.Error()),
+			}
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				h.sendWebSocket(ctx, sess, resp)
+			}()
+			continue
+		}
+
+		// Notifications carry no id and expect no response
+		if req.ID == nil {
+			h.handleNotification(&jsonrpc.Notification{
+				JSONRPC: req.JSONRPC,
+				Method:  req.Method,
+				Params:  req.Params,
+			})
+			continue
+		}
+
+		if ok, retryAfter := h.allowSessionRequest(sess); !ok {
+			resp := &jsonrpc.Response{
+				JSONRPC: jsonrpc.Version,
+				ID:      req.ID,
+				Error:   jsonrpc.NewRateLimitError("Too many requests", retryAfterSeconds(retryAfter)),
+			}
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				h.sendWebSocket(ctx, sess, resp)
+			}()
+			continue
+		}
+
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			h.sendWebSocket(ctx, sess, h.dispatch(ctx, &req))
+		}()
+	}
+}
+
+// writeWebSocket writes the session's queued messages and periodic pings to
+// conn until the session or handler closes or a write fails.
+func (h *Handler) writeWebSocket(conn *websocket.Conn, sess *session) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-sess.done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(wsWriteWait))
+			return
+		case <-h.closed:
+			// Closing the connection also ends the read loop
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			conn.Close()
+			return
+		case msg := <-sess.messages:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				h.logger.Error().Err(err).Str("session_id", sess.id).Msg("Failed to send WebSocket message")
+				conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				h.logger.Error().Err(err).Str("session_id", sess.id).Msg("Failed to send WebSocket ping")
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// sendWebSocket queues a response for the session's writer.
+func (h *Handler) sendWebSocket(ctx context.Context, sess *session, resp *jsonrpc.Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to marshal JSON response")
+		return
+	}
+	if !sess.send(ctx, data) {
+		h.logger.Debug().Str("session_id", sess.id).Msg("Dropped response for closed WebSocket")
+	}
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket connects to h's WebSocket endpoint.
+func dialWebSocket(t *testing.T, h *Handler) *websocket.Conn {
+	t.Helper()
+
+	srv := newTestServer(t, http.HandlerFunc(h.HandleWebSocket))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// wsCall sends one request and reads the next message.
+func wsCall(t *testing.T, conn *websocket.Conn, request string) map[string]json.RawMessage {
+	t.Helper()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(request)); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", data, err)
+	}
+	return resp
+}
+
+func TestWebSocketInitializeAndToolCall(t *testing.T) {
+	conn := dialWebSocket(t, newTestHandler(t))
+
+	resp := wsCall(t, conn, initializeRequest)
+	if string(resp["id"]) != "1" || resp["error"] != nil {
+		t.Fatalf("initialize response = %v, want a result for id 1", resp)
+	}
+	if !strings.Contains(string(resp["result"]), `"serverInfo"`) {
+		t.Fatalf("initialize result = %s, want serverInfo", resp["result"])
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = wsCall(t, conn, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`)
+	if string(resp["id"]) != "2" {
+		t.Fatalf("tools/call id = %s, want 2", resp["id"])
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(resp["result"], &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Fatalf("tools/call result = %s, want the echoed text", resp["result"])
+	}
+}
+
+func TestWebSocketParseError(t *testing.T) {
+	conn := dialWebSocket(t, newTestHandler(t))
+
+	resp := wsCall(t, conn, `{not json`)
+	if !strings.Contains(string(resp["error"]), `"code":-32700`) {
+		t.Fatalf("response = %v, want a parse error", resp)
+	}
+}
+
+func TestWebSocketSessionClosedOnDisconnect(t *testing.T) {
+	h := newTestHandler(t)
+	conn := dialWebSocket(t, h)
+	wsCall(t, conn, initializeRequest)
+	if n := h.sessions.count(); n != 1 {
+		t.Fatalf("open sessions = %d, want 1", n)
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	deadline := time.Now().Add(2 * time.Second)
+	for h.sessions.count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("session still open after the client closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketMaxSessions(t *testing.T) {
+	h := newTestHandler(t)
+	h.SetMaxSessions(1)
+	// A reply means the first connection's session is open
+	wsCall(t, dialWebSocket(t, h), initializeRequest)
+
+	conn := dialWebSocket(t, h)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Fatalf("read error = %v, want close %d", err, websocket.CloseTryAgainLater)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/mcp"
+)
+
+// accessLog returns middleware that logs one structured line per request
+// once it completes. Long-lived streams are logged when they close. The
+// session id is read from the headers the MCP handler accepts.
+func accessLog(logger zerolog.Logger, mcpHandler *mcp.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					// Nothing was written. A hijacked WebSocket upgrade switched
+					// protocols; anything else got net/http's implicit 200
+					status = http.StatusOK
+					if isWebSocketUpgrade(r) {
+						status = http.StatusSwitchingProtocols
+					}
+				}
+
+				event := logger.Info()
+				switch {
+				case status >= http.StatusInternalServerError:
+					event = logger.Error()
+				case status >= http.StatusBadRequest:
+					event = logger.Warn()
+				}
+
+				event.
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Int("status", status).
+					Dur("duration", time.Since(start)).
+					Int("bytes", ww.BytesWritten()).
+					Str("remote", r.RemoteAddr).
+					Str("request_id", middleware.GetReqID(r.Context())).
+					Str("session_id", requestSessionID(mcpHandler, r, ww.Header())).
+					Msg("Request completed")
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// requestSessionID returns the MCP session a request belonged to, whether
+// it was sent by the client or assigned in the response.
+func requestSessionID(mcpHandler *mcp.Handler, r *http.Request, respHeader http.Header) string {
+	if id := mcpHandler.RequestSessionID(r); id != "" {
+		return id
+	}
+	if id := r.URL.Query().Get("sessionId"); id != "" {
+		return id
+	}
+	return respHeader.Get(mcp.SessionIDHeader)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/mcp"
+	"mcp-sse-go/internal/tools"
+)
+
+// accessLine is an access log line as written by accessLog.
+type accessLine struct {
+	Level     string   `json:"level"`
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	Status    int      `json:"status"`
+	Duration  *float64 `json:"duration"`
+	RequestID string   `json:"request_id"`
+	SessionID string   `json:"session_id"`
+	Message   string   `json:"message"`
+}
+
+// accessLines returns the access log lines among the JSON lines in logs.
+func accessLines(t *testing.T, logs *bytes.Buffer) []accessLine {
+	t.Helper()
+
+	var lines []accessLine
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		var line accessLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", scanner.Text(), err)
+		}
+		if line.Message == "Request completed" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := New(Config{
+		Logger:             &logger,
+		Context:            ctx,
+		DisableWeatherTool: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+
+	for _, path := range []string{"/health", "/missing"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(middleware.RequestIDHeader, "req"+path)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := accessLines(t, &logs)
+	want := []accessLine{
+		{Level: "info", Method: http.MethodGet, Path: "/health", Status: http.StatusOK, RequestID: "req/health"},
+		{Level: "warn", Method: http.MethodGet, Path: "/missing", Status: http.StatusNotFound, RequestID: "req/missing"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("access log lines = %+v, want %d", lines, len(want))
+	}
+	for i, line := range lines {
+		if line.Duration == nil || *line.Duration < 0 {
+			t.Errorf("line %d: duration = %v, want a non-negative duration", i+1, line.Duration)
+		}
+		line.Duration, line.Message = nil, ""
+		if line != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i+1, line, want[i])
+		}
+	}
+}
+
+func TestAccessLogStatusWhenNothingWritten(t *testing.T) {
+	var logs bytes.Buffer
+	handler := accessLog(zerolog.New(&logs), mcp.NewHandler(tools.NewRegistry()))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	upgrade := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	handler.ServeHTTP(httptest.NewRecorder(), upgrade)
+
+	lines := accessLines(t, &logs)
+	if len(lines) != 2 {
+		t.Fatalf("access log lines = %+v, want 2", lines)
+	}
+	if lines[0].Status != http.StatusOK {
+		t.Errorf("plain request: status = %d, want %d", lines[0].Status, http.StatusOK)
+	}
+	if lines[1].Status != http.StatusSwitchingProtocols {
+		t.Errorf("WebSocket upgrade: status = %d, want %d", lines[1].Status, http.StatusSwitchingProtocols)
+	}
+}
+
+func TestAccessLogSessionID(t *testing.T) {
+	var logs bytes.Buffer
+	mcpHandler := mcp.NewHandler(tools.NewRegistry())
+	mcpHandler.SetSessionHeaderAliases("X-Session-Id")
+	handler := accessLog(zerolog.New(&logs), mcpHandler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/assigned" {
+			w.Header().Set(mcp.SessionIDHeader, "assigned")
+		}
+	}))
+
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "session header", target: "/mcp", headers: map[string]string{mcp.SessionIDHeader: "canonical"}, want: "canonical"},
+		{name: "alias header", target: "/mcp", headers: map[string]string{"X-Session-Id": "alias"}, want: "alias"},
+		{name: "canonical over alias", target: "/mcp", headers: map[string]string{mcp.SessionIDHeader: "canonical", "X-Session-Id": "alias"}, want: "canonical"},
+		{name: "query", target: "/sse?sessionId=query", want: "query"},
+		{name: "assigned", target: "/assigned", want: "assigned"},
+		{name: "none", target: "/mcp", want: ""},
+	}
+	for _, tt := range tests {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := accessLines(t, &logs)
+		if len(lines) != 1 || lines[0].SessionID != tt.want {
+			t.Errorf("%s: access log lines = %+v, want session %q", tt.name, lines, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// DefaultAPIKeyHeader is the request header API keys are read from when
+// Config.APIKeyHeader is empty.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// KeySet returns a validator that accepts any of the given keys.
+func KeySet(keys []string) func(string) bool {
+	return func(key string) bool {
+		valid := false
+		for _, k := range keys {
+			// Check every key so the timing doesn't reveal which one matched
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				valid = true
+			}
+		}
+		return valid
+	}
+}
+
+// APIKeyAuth returns middleware that rejects requests whose header does not
+// carry a key accepted by validate, answering 401 with a WWW-Authenticate
+// challenge. Requests for the exempt paths and CORS preflights pass through.
+func APIKeyAuth(header string, validate func(string) bool, exempt ...string) func(http.Handler) http.Handler {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions || exemptPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Header.Get(header)
+			if key == "" || !validate(key) {
+				w.Header().Set("WWW-Authenticate", `APIKey header="`+header+`"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
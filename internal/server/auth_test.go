@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := APIKeyAuth("X-Key", KeySet([]string{"alpha", "beta"}), "/health")(ok)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{name: "missing key", method: http.MethodPost, path: "/mcp", want: http.StatusUnauthorized},
+		{name: "wrong key", method: http.MethodPost, path: "/mcp", key: "gamma", want: http.StatusUnauthorized},
+		{name: "correct key", method: http.MethodPost, path: "/mcp", key: "beta", want: http.StatusOK},
+		{name: "exempt path", method: http.MethodGet, path: "/health", want: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, path: "/mcp", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set("X-Key", tt.key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		challenge := rec.Header().Get("WWW-Authenticate")
+		if wantChallenge := tt.want == http.StatusUnauthorized; wantChallenge != (challenge == `APIKey header="X-Key"`) {
+			t.Errorf("%s: WWW-Authenticate = %q", tt.name, challenge)
+		}
+	}
+}
+
+func TestAPIKeysExemptHealthByDefault(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := zerolog.Nop()
+	handler, err := New(Config{
+		Logger:             &logger,
+		Context:            ctx,
+		DisableWeatherTool: true,
+		APIKeys:            []string{"alpha"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+
+	for path, want := range map[string]int{
+		"/health":  http.StatusOK,
+		"/version": http.StatusUnauthorized,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set(DefaultAPIKeyHeader, "alpha")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("/version with a key: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// compressibleTypes are the content types worth gzipping.
+var compressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xhtml+xml",
+	"text/css",
+	"text/html",
+	"text/plain",
+}
+
+// compressExceptStreams returns middleware that compresses responses the
+// client accepts gzip or deflate for. Event streams and WebSocket upgrades
+// bypass it entirely so every event is flushed to the client as written.
+func compressExceptStreams(level int) func(http.Handler) http.Handler {
+	compress := middleware.Compress(level, compressibleTypes...)
+
+	return func(next http.Handler) http.Handler {
+		compressed := compress(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isStreaming reports whether r may be answered with a long-lived stream.
+func isStreaming(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		isWebSocketUpgrade(r)
+}
+
+// isWebSocketUpgrade reports whether r asks to upgrade to a WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
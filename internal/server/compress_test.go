@@ -0,0 +1,82 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressExceptStreams(t *testing.T) {
+	body := `{"result":"` + strings.Repeat("sunny ", 200) + `"}`
+	handler := compressExceptStreams(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreaming(r) {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		io.WriteString(w, body)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		wantGzip bool
+	}{
+		{
+			name:     "JSON",
+			method:   http.MethodPost,
+			headers:  map[string]string{"Accept": "application/json"},
+			wantGzip: true,
+		},
+		{
+			name:    "SSE GET",
+			method:  http.MethodGet,
+			headers: map[string]string{"Accept": "text/event-stream"},
+		},
+		{
+			name:    "Streamable POST",
+			method:  http.MethodPost,
+			headers: map[string]string{"Accept": "application/json, text/event-stream"},
+		},
+		{
+			name:    "WebSocket upgrade",
+			method:  http.MethodGet,
+			headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"},
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/mcp", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+		if gzipped != tt.wantGzip {
+			t.Errorf("%s: Content-Encoding = %q, want gzip %v", tt.name, rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			continue
+		}
+
+		var got []byte
+		if gzipped {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		} else {
+			got = rec.Body.Bytes()
+		}
+		if string(got) != body {
+			t.Errorf("%s: body = %q, want it unchanged", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/tools"
+)
+
+// Option adjusts the Config passed to New or NewMCPHandler. Options are
+// applied in order, after the Config fields are read.
+type Option func(*Config)
+
+// WithLogger routes the server's logs through logger.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(cfg *Config) {
+		cfg.Logger = &logger
+	}
+}
+
+// WithContext stops the server's background work when ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(cfg *Config) {
+		cfg.Context = ctx
+	}
+}
+
+// WithTool registers tool alongside the built-in tools. A tool with the
+// same name as a built-in one replaces it.
+func WithTool(tool tools.Tool) Option {
+	return func(cfg *Config) {
+		cfg.Tools = append(cfg.Tools, tool)
+	}
+}
+
+// WithoutWeatherTool leaves the built-in weather tool unregistered.
+func WithoutWeatherTool() Option {
+	return func(cfg *Config) {
+		cfg.DisableWeatherTool = true
+	}
+}
+
+// WithToolMiddleware wraps every tool call in middleware, outermost first.
+func WithToolMiddleware(middleware ...tools.ToolMiddleware) Option {
+	return func(cfg *Config) {
+		cfg.ToolMiddleware = append(cfg.ToolMiddleware, middleware...)
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+
+	"mcp-sse-go/internal/tools"
+)
+
+// shoutTool returns its text argument in upper case.
+type shoutTool struct {
+	*tools.DefaultTool
+}
+
+func (shoutTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	var params struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tools.Result{Content: []tools.Content{tools.TextContent(strings.ToUpper(params.Text))}})
+}
+
+func TestOptionsSetConfig(t *testing.T) {
+	var logs bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cfg Config
+	for _, opt := range []Option{WithLogger(zerolog.New(&logs)), WithContext(ctx), WithoutWeatherTool()} {
+		opt(&cfg)
+	}
+	if cfg.context() != ctx {
+		t.Error("WithContext did not set the lifecycle context")
+	}
+	if !cfg.DisableWeatherTool {
+		t.Error("WithoutWeatherTool left the weather tool enabled")
+	}
+	logger := cfg.logger()
+	logger.Info().Msg("hello")
+	if !strings.Contains(logs.String(), "hello") {
+		t.Errorf("logs = %q, want WithLogger's logger used", logs.String())
+	}
+}
+
+func TestOptionsRegisterToolsAndMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) tools.ToolMiddleware {
+		return func(tool tools.Tool) tools.Tool {
+			return tools.WrapCall(tool, func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+				calls = append(calls, name+" "+tool.Name())
+				return tool.Call(ctx, args)
+			})
+		}
+	}
+
+	logger := zerolog.Nop()
+	h, err := NewMCPHandler(Config{},
+		WithLogger(logger),
+		WithoutWeatherTool(),
+		WithTool(shoutTool{tools.NewDefaultTool("shout", "Shouts its text")}),
+		WithToolMiddleware(record("outer")),
+		WithToolMiddleware(record("inner")),
+	)
+	if err != nil {
+		t.Fatalf("NewMCPHandler: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	tr := h.NewMemoryTransport(ctx)
+	defer tr.Close()
+
+	send := func(request string) string {
+		t.Helper()
+		if err := tr.Send(ctx, []byte(request)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		data, err := tr.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		return string(data)
+	}
+
+	if resp := send(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); !strings.Contains(resp, `"name":"shout"`) || strings.Contains(resp, `"name":"weather"`) {
+		t.Fatalf("tools/list = %s, want only the shout tool", resp)
+	}
+	if resp := send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"shout","arguments":{"text":"hi"}}}`); !strings.Contains(resp, `"text":"HI"`) {
+		t.Fatalf("tools/call = %s, want the shouted text", resp)
+	}
+	if got, want := fmt.Sprint(calls), "[outer shout inner shout]"; got != want {
+		t.Fatalf("middleware calls = %s, want %s", got, want)
+	}
+}
+
+func TestInjectedLoggerReceivesLogs(t *testing.T) {
+	// Nothing should reach the global logger
+	var global bytes.Buffer
+	orig := zlog.Logger
+	zlog.Logger = zerolog.New(&global)
+	defer func() { zlog.Logger = orig }()
+
+	var logs bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := New(Config{}, WithLogger(zerolog.New(&logs)), WithContext(ctx))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)))
+
+	for _, msg := range []string{"Registered tool", "Created streamable HTTP session", "Request completed"} {
+		if !strings.Contains(logs.String(), msg) {
+			t.Errorf("injected logger has no %q line:\n%s", msg, logs.String())
+		}
+	}
+	if global.Len() != 0 {
+		t.Errorf("global logger received:\n%s", global.String())
+	}
+}
+
+// toolNames returns the names of the tools a handler built with opts lists.
+func toolNames(t *testing.T, opts ...Option) []string {
+	t.Helper()
+
+	defs, err := ToolDefinitions(Config{}, append([]Option{WithLogger(zerolog.Nop())}, opts...)...)
+	if err != nil {
+		t.Fatalf("ToolDefinitions: %v", err)
+	}
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		names = append(names, def["name"].(string))
+	}
+	return names
+}
+
+func TestWithToolRegistersAlongsideWeather(t *testing.T) {
+	shout := shoutTool{tools.NewDefaultTool("shout", "Shouts its text")}
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "default", want: "[weather]"},
+		{name: "custom tool", opts: []Option{WithTool(shout)}, want: "[shout weather]"},
+		{name: "without weather", opts: []Option{WithTool(shout), WithoutWeatherTool()}, want: "[shout]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(toolNames(t, tt.opts...)); got != tt.want {
+			t.Errorf("%s: tools = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// A custom tool named like the built-in one replaces it
+	replacement := shoutTool{tools.NewDefaultTool("weather", "Shouts the weather")}
+	defs, err := ToolDefinitions(Config{}, WithLogger(zerolog.Nop()), WithTool(replacement))
+	if err != nil {
+		t.Fatalf("ToolDefinitions: %v", err)
+	}
+	if len(defs) != 1 || defs[0]["description"] != "Shouts the weather" {
+		t.Fatalf("tools = %v, want only the replacement", defs)
+	}
+}
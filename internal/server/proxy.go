@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"mcp-sse-go/internal/mcp"
+)
+
+// peerKey is the context key for the address of the directly connected peer.
+type peerKey struct{}
+
+// capturePeer records r.RemoteAddr before the RealIP middleware replaces it
+// with a client-supplied forwarding header.
+func capturePeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), peerKey{}, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recordClientIP returns middleware that records the address per-client
+// limits are keyed by. It is the directly connected peer unless that peer is
+// a trusted proxy, in which case the forwarded address RealIP put in
+// RemoteAddr is used. Clients can't dodge a block by varying the headers.
+// It must run after RealIP.
+func recordClientIP(proxies trustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := r.RemoteAddr
+			if len(proxies) == 0 || !proxies.trusts(r) {
+				if peer, ok := r.Context().Value(peerKey{}).(string); ok {
+					addr = peer
+				}
+			}
+			ctx := mcp.WithClientIP(r.Context(), hostOnly(addr))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// hostOnly strips the port, if any, from addr.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// trustedProxies is the set of networks whose forwarding headers are honored.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses IP addresses and CIDR ranges.
+func parseTrustedProxies(entries []string) (trustedProxies, error) {
+	proxies := make(trustedProxies, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusts reports whether r arrived directly from a trusted proxy.
+func (p trustedProxies) trusts(r *http.Request) bool {
+	peer, ok := r.Context().Value(peerKey{}).(string)
+	if !ok {
+		peer = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(hostOnly(peer))
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstForwarded returns the first entry of a comma-separated forwarding
+// header, which the outermost proxy set.
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newLookupLimitedServer returns a server that blocks a client after two
+// unknown session ids.
+func newLookupLimitedServer(t *testing.T, trustedProxies ...string) http.Handler {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	logger := zerolog.Nop()
+	handler, err := New(Config{
+		Logger:                  &logger,
+		Context:                 ctx,
+		DisableWeatherTool:      true,
+		MaxFailedSessionLookups: 2,
+		SessionLookupWindow:     time.Minute,
+		TrustedProxies:          trustedProxies,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+	return handler
+}
+
+// lookupFrom sends a request for an unknown session from peer, claiming to
+// be forwardedFor, and returns the status.
+func lookupFrom(handler http.Handler, peer, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	req.RemoteAddr = peer
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Mcp-Session-Id", "unknown")
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestSpoofedForwardedForDoesNotDodgeBlock(t *testing.T) {
+	handler := newLookupLimitedServer(t)
+
+	statuses := []int{
+		lookupFrom(handler, "192.0.2.1:1234", "203.0.113.1"),
+		lookupFrom(handler, "192.0.2.1:1234", "203.0.113.2"),
+		lookupFrom(handler, "192.0.2.1:1234", "203.0.113.3"),
+	}
+	want := []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", statuses, want)
+		}
+	}
+}
+
+func TestTrustedProxyForwardedForKeysBlock(t *testing.T) {
+	handler := newLookupLimitedServer(t, "192.0.2.1")
+
+	// Behind a trusted proxy each forwarded client has its own count
+	for _, client := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		if status := lookupFrom(handler, "192.0.2.1:1234", client); status != http.StatusNotFound {
+			t.Fatalf("client %s: status = %d, want %d", client, status, http.StatusNotFound)
+		}
+	}
+	lookupFrom(handler, "192.0.2.1:1234", "203.0.113.1")
+	if status := lookupFrom(handler, "192.0.2.1:1234", "203.0.113.1"); status != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
+
+// ideConfigURL requests /.mcp/ide-config from peer with the forwarding
+// headers and returns the advertised SSE URL.
+func ideConfigURL(t *testing.T, handler http.Handler, peer string, headers map[string]string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/.mcp/ide-config", nil)
+	req.Host = "internal:8080"
+	req.RemoteAddr = peer
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var config map[string]IDEConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body, err)
+	}
+	return config["my-mcp-server"].URL
+}
+
+func TestForwardedHostAndProtoFromTrustedProxiesOnly(t *testing.T) {
+	forwarded := map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "mcp.example.com",
+	}
+	tests := []struct {
+		name    string
+		proxies []string
+		peer    string
+		want    string
+	}{
+		{
+			name:    "trusted proxy",
+			proxies: []string{"10.0.0.0/8"},
+			peer:    "10.1.2.3:4567",
+			want:    "https://mcp.example.com/sse",
+		},
+		{
+			name:    "untrusted peer",
+			proxies: []string{"10.0.0.0/8"},
+			peer:    "192.0.2.1:4567",
+			want:    "http://internal:8080/sse",
+		},
+		{
+			name: "no proxies configured",
+			peer: "10.1.2.3:4567",
+			want: "http://internal:8080/sse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newLookupLimitedServer(t, tt.proxies...)
+			if got := ideConfigURL(t, handler, tt.peer, forwarded); got != tt.want {
+				t.Errorf("URL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
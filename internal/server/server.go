@@ -1,21 +1,30 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"fmt"
+	"io"
 	"io/fs"
-	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
 
 	"mcp-sse-go/internal/mcp"
 	"mcp-sse-go/internal/tools"
 	"mcp-sse-go/internal/tools/weather"
+	"mcp-sse-go/internal/version"
 )
 
 //go:embed web/static/*
@@ -27,9 +36,297 @@ type IDEConfig struct {
 	Headers map[string]string `json:"headers"`
 }
 
+// Session limit defaults, used when the Config leaves them zero.
+const (
+	DefaultMaxSessions        = 10000
+	DefaultSessionIdleTimeout = 30 * time.Minute
+)
+
 // Config contains the server configuration.
 type Config struct {
-	// No configuration needed as API key and URL come from headers
+	// Logger receives the logs of the server, its middleware and handlers.
+	// Nil means the global zerolog logger.
+	Logger *zerolog.Logger
+
+	// Context bounds the server's background work, such as metrics
+	// notifications and session webhooks, which stops when it is done or
+	// when the Server is closed, whichever comes first.
+	Context context.Context
+
+	// Tools are registered in addition to the built-in weather tool.
+	Tools []tools.Tool
+
+	// DisableWeatherTool leaves the built-in weather tool unregistered, for
+	// embedders serving only their own tools. The Weather* settings are
+	// then ignored.
+	DisableWeatherTool bool
+
+	// ToolMiddleware wraps every tool call, outermost first.
+	ToolMiddleware []tools.ToolMiddleware
+
+	// WeatherAPIURL is the weather API used when a request carries no
+	// X-Weather-API-URL header. Empty means weather.DefaultAPIURL. The API
+	// key still comes from each request.
+	WeatherAPIURL string
+
+	// WeatherAmbiguityPolicy is the default policy the weather tool applies
+	// when a city matches several locations. Empty means weather.AmbiguityFirst.
+	WeatherAmbiguityPolicy weather.AmbiguityPolicy
+
+	// CacheToolResults enables the result cache for tools that opt in.
+	CacheToolResults bool
+
+	// WeatherCacheTTL is how long weather results are cached when
+	// CacheToolResults is set. Zero leaves the weather tool uncached. Results
+	// are only shared between calls with the same API URL and key.
+	WeatherCacheTTL time.Duration
+
+	// ToolCacheTTLs sets the cache TTL of tools by name when CacheToolResults
+	// is set, overriding tool-specific settings such as WeatherCacheTTL.
+	ToolCacheTTLs map[string]time.Duration
+
+	// WeatherBreakerThreshold is how many consecutive failed requests to a
+	// weather API open its circuit breaker. Zero disables the breaker.
+	WeatherBreakerThreshold int
+
+	// WeatherBreakerCooldown is how long an open breaker fails calls fast
+	// before letting a probe through. Zero means 30 seconds.
+	WeatherBreakerCooldown time.Duration
+
+	// CompressResponses gzips JSON and web UI responses for clients that
+	// accept it. Event streams and WebSockets are never compressed.
+	CompressResponses bool
+
+	// AuditLog enables the audit trail of tool executions: "log" writes it
+	// to the server log, any other value is a file that JSON lines are
+	// appended to. Empty disables it.
+	AuditLog string
+
+	// SessionWebhookURL receives a POSTed JSON event whenever a session is
+	// created, deleted or expires. Empty disables it.
+	SessionWebhookURL string
+
+	// DebugPprof serves the net/http/pprof profiles under /debug/pprof/.
+	// They expose internals, so leave it off unless diagnosing a problem.
+	DebugPprof bool
+
+	// DisableWebUI stops the /config page and /static assets from being
+	// served, for headless deployments.
+	DisableWebUI bool
+
+	// MetricsNotificationInterval enables periodic notifications/metrics
+	// messages on open SSE streams. Zero disables them.
+	MetricsNotificationInterval time.Duration
+
+	// MaxFailedSessionLookups is how many unknown session ids one IP may
+	// present within SessionLookupWindow before it is blocked with 429 for
+	// SessionLookupCooldown. Zero disables the protection.
+	MaxFailedSessionLookups int
+
+	// SessionLookupWindow is the period failed lookups are counted over.
+	// Zero means one second.
+	SessionLookupWindow time.Duration
+
+	// SessionLookupCooldown is how long a blocked IP stays blocked. Zero
+	// means one SessionLookupWindow.
+	SessionLookupCooldown time.Duration
+
+	// SessionRequestRate limits each session to this many requests per
+	// second, with bursts of up to SessionRequestBurst. Zero disables it.
+	SessionRequestRate float64
+
+	// SessionRequestBurst is the per-session burst size. Zero means one.
+	SessionRequestBurst int
+
+	// MaxSessions bounds how many sessions may be open at once; further
+	// ones are refused with 503. Zero means DefaultMaxSessions.
+	MaxSessions int
+
+	// SessionIdleTimeout closes sessions unused for this long, unless they
+	// have an open stream. Zero means DefaultSessionIdleTimeout.
+	SessionIdleTimeout time.Duration
+
+	// SessionSweepJitter delays each idle-session sweep by a random extra
+	// of up to this long, spreading the sweeps of servers started
+	// together. Zero sweeps at a fixed interval.
+	SessionSweepJitter time.Duration
+
+	// EventReplayWindow is how many sent messages each session keeps so a
+	// Streamable HTTP client reopening its stream with Last-Event-ID gets
+	// the ones it missed. Zero disables replay.
+	EventReplayWindow int
+
+	// MaxConcurrentToolCalls bounds how many tool calls run at once. Zero
+	// means no limit.
+	MaxConcurrentToolCalls int
+
+	// ToolConcurrencyLimits bounds concurrent calls of individual tools by
+	// name, in addition to MaxConcurrentToolCalls.
+	ToolConcurrencyLimits map[string]int
+
+	// ToolCallQueueTimeout is how long a call over a concurrency limit waits
+	// for a slot before failing as busy. Zero rejects it immediately.
+	ToolCallQueueTimeout time.Duration
+
+	// RequestTimeout bounds how long a non-streaming HTTP request may take.
+	// Zero means no limit.
+	RequestTimeout time.Duration
+
+	// MaxToolResultSize bounds the serialized size of a tool result in
+	// bytes. Larger results fail with a JSON-RPC error. Zero means no limit.
+	MaxToolResultSize int
+
+	// SessionHeaderAliases are extra request headers the Streamable HTTP
+	// transport reads the session id from when Mcp-Session-Id is absent.
+	SessionHeaderAliases []string
+
+	// AnonymousTools names the tools that may be called on the Streamable
+	// HTTP transport without a session.
+	AnonymousTools []string
+
+	// PublicBaseURL is the externally visible base URL, e.g.
+	// "https://mcp.example.com". When set it is advertised instead of the
+	// URL derived from request headers, and SSE streams announce their
+	// message endpoint as an absolute URL under it.
+	PublicBaseURL string
+
+	// TrustedProxies lists the IP addresses and CIDR ranges of reverse
+	// proxies whose X-Forwarded-Proto and X-Forwarded-Host headers are used
+	// to build advertised URLs.
+	TrustedProxies []string
+
+	// APIKeys enables API-key authentication on every HTTP endpoint except
+	// APIKeyExemptPaths. APIKeyValidator, when set, is used instead.
+	APIKeys []string
+
+	// APIKeyValidator reports whether a presented key is valid.
+	APIKeyValidator func(key string) bool
+
+	// APIKeyHeader is the header carrying the key. Empty means
+	// DefaultAPIKeyHeader.
+	APIKeyHeader string
+
+	// APIKeyExemptPaths are served without a key. Nil means /health only.
+	APIKeyExemptPaths []string
+}
+
+// logger returns the configured logger, or the global zerolog logger.
+func (cfg Config) logger() zerolog.Logger {
+	if cfg.Logger != nil {
+		return *cfg.Logger
+	}
+	return zlog.Logger
+}
+
+// context returns the configured lifecycle context, or context.Background.
+func (cfg Config) context() context.Context {
+	if cfg.Context != nil {
+		return cfg.Context
+	}
+	return context.Background()
+}
+
+// Validate reports the first setting in cfg that cannot be used. Tool names
+// are checked when the handler is built, since they depend on the registry.
+func (cfg Config) Validate() error {
+	if cfg.WeatherAmbiguityPolicy != "" && !cfg.WeatherAmbiguityPolicy.Valid() {
+		return fmt.Errorf("invalid weather ambiguity policy: %q", cfg.WeatherAmbiguityPolicy)
+	}
+
+	durations := map[string]time.Duration{
+		"weather cache TTL":             cfg.WeatherCacheTTL,
+		"metrics notification interval": cfg.MetricsNotificationInterval,
+		"session lookup window":         cfg.SessionLookupWindow,
+		"session lookup cooldown":       cfg.SessionLookupCooldown,
+		"tool call queue timeout":       cfg.ToolCallQueueTimeout,
+		"request timeout":               cfg.RequestTimeout,
+		"session idle timeout":          cfg.SessionIdleTimeout,
+		"session sweep jitter":          cfg.SessionSweepJitter,
+		"weather breaker cooldown":      cfg.WeatherBreakerCooldown,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative: %s", name, d)
+		}
+	}
+	for name, ttl := range cfg.ToolCacheTTLs {
+		if ttl < 0 {
+			return fmt.Errorf("cache TTL of tool %q must not be negative: %s", name, ttl)
+		}
+	}
+
+	counts := map[string]int{
+		"max failed session lookups": cfg.MaxFailedSessionLookups,
+		"session request burst":      cfg.SessionRequestBurst,
+		"event replay window":        cfg.EventReplayWindow,
+		"max sessions":               cfg.MaxSessions,
+		"max concurrent tool calls":  cfg.MaxConcurrentToolCalls,
+		"weather breaker threshold":  cfg.WeatherBreakerThreshold,
+		"max tool result size":       cfg.MaxToolResultSize,
+	}
+	for name, n := range counts {
+		if n < 0 {
+			return fmt.Errorf("%s must not be negative: %d", name, n)
+		}
+	}
+	if cfg.SessionRequestRate < 0 {
+		return fmt.Errorf("session request rate must not be negative: %g", cfg.SessionRequestRate)
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return err
+	}
+	if cfg.SessionWebhookURL != "" {
+		u, err := url.Parse(cfg.SessionWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("session webhook URL must be an absolute http or https URL: %q", cfg.SessionWebhookURL)
+		}
+	}
+	if cfg.PublicBaseURL != "" {
+		u, err := url.Parse(cfg.PublicBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("public base URL must be an absolute http or https URL: %q", cfg.PublicBaseURL)
+		}
+	}
+	if cfg.AuditLog != "" && cfg.AuditLog != "log" {
+		if err := checkAuditLogPath(cfg.AuditLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAuditLogPath reports whether an audit log could be opened at path,
+// without creating it: the file must be a regular file if it exists, and
+// its directory must exist.
+func checkAuditLogPath(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("audit log is not a regular file: %q", path)
+		}
+		return nil
+	}
+	dir, err := os.Stat(filepath.Dir(path))
+	if err != nil || !dir.IsDir() {
+		return fmt.Errorf("audit log directory does not exist: %q", filepath.Dir(path))
+	}
+	return nil
+}
+
+// CheckConfig reports whether a handler could be built from cfg, including
+// the checks that need the tool registry, without opening the audit log or
+// starting anything. It backs the -check-config dry run.
+func CheckConfig(cfg Config, opts ...Option) error {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// The audit log path has been validated; building its sink would create it
+	cfg.AuditLog = ""
+	_, err := NewMCPHandler(cfg)
+	return err
 }
 
 // fileServer is a wrapper around http.FileServer that works with embedded files
@@ -48,58 +345,344 @@ func fileServer(r chi.Router, path string, root fs.FS) {
 	})
 }
 
-// getBaseURL extracts the base URL from the request
-func getBaseURL(r *http.Request) string {
+// mountWebUI registers the configuration page and the embedded static files.
+func mountWebUI(r chi.Router) error {
+	// Serve static files from embedded filesystem
+	staticRoot, err := fs.Sub(staticFS, "web/static")
+	if err != nil {
+		return fmt.Errorf("failed to create sub filesystem: %w", err)
+	}
+
+	// Configuration page
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		data, err := staticFS.ReadFile("web/static/config.xhtml")
+		if err != nil {
+			http.Error(w, "Configuration page not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xhtml+xml")
+		w.Write(data)
+	})
+
+	// Serve static files
+	fileServer(r, "/static", staticRoot)
+	return nil
+}
+
+// echoRequestID returns the id assigned by the RequestID middleware in the
+// X-Request-Id response header, so clients can quote it when reporting
+// problems.
+func echoRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getBaseURL extracts the base URL from the request. X-Forwarded-Proto and
+// X-Forwarded-Host are honored only from trusted proxies, so with none
+// configured the URL reflects the connection itself.
+func getBaseURL(r *http.Request, proxies trustedProxies) string {
+	trusted := proxies.trusts(r)
+
 	scheme := "http://"
-	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+	if r.TLS != nil || (trusted && firstForwarded(r.Header.Get("X-Forwarded-Proto")) == "https") {
 		scheme = "https://"
 	}
-	return scheme + r.Host
+
+	host := r.Host
+	if forwarded := firstForwarded(r.Header.Get("X-Forwarded-Host")); trusted && forwarded != "" {
+		host = forwarded
+	}
+	return scheme + host
 }
 
-// New creates a new HTTP handler with the given configuration.
-func New(cfg Config) (http.Handler, error) {
+// NewMCPHandler creates the MCP handler and its tool registry, independent
+// of the transport it will be served over.
+func NewMCPHandler(cfg Config, opts ...Option) (*mcp.Handler, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	logger := cfg.logger()
+	toolRegistry, err := newToolRegistry(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	toolList := toolRegistry.List()
+
+	// Create MCP handler
+	mcpHandler := mcp.NewHandler(toolRegistry)
+	mcpHandler.SetLogger(logger)
+	logger.Info().Int("tool_count", len(toolList)).Msg("Created new MCP handler")
+	lookupWindow := cfg.SessionLookupWindow
+	if lookupWindow <= 0 {
+		lookupWindow = time.Second
+	}
+	mcpHandler.SetSessionLookupLimit(cfg.MaxFailedSessionLookups, lookupWindow, cfg.SessionLookupCooldown)
+	mcpHandler.SetSessionRateLimit(cfg.SessionRequestRate, cfg.SessionRequestBurst)
+	mcpHandler.SetEventReplayWindow(cfg.EventReplayWindow)
+	maxSessions := cfg.MaxSessions
+	if maxSessions == 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	mcpHandler.SetMaxSessions(maxSessions)
+	mcpHandler.SetSessionHeaderAliases(cfg.SessionHeaderAliases...)
+	mcpHandler.SetPublicBaseURL(cfg.PublicBaseURL)
+	switch cfg.AuditLog {
+	case "":
+	case "log":
+		mcpHandler.SetAuditSink(mcp.NewLogAuditSink(logger))
+	default:
+		f, err := os.OpenFile(cfg.AuditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		mcpHandler.SetAuditSink(mcp.NewJSONAuditSink(f))
+	}
+	return mcpHandler, nil
+}
+
+// ToolDefinitions returns the definitions of the tools a handler built from
+// cfg would serve, sorted by name. Unlike NewMCPHandler it opens no audit
+// log. It backs -dump-tools.
+func ToolDefinitions(cfg Config, opts ...Option) ([]map[string]any, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	toolRegistry, err := newToolRegistry(cfg, cfg.logger())
+	if err != nil {
+		return nil, err
+	}
+	toolList := toolRegistry.Sorted()
+	defs := make([]map[string]any, 0, len(toolList))
+	for _, tool := range toolList {
+		defs = append(defs, tool.GetToolDefinition())
+	}
+	return defs, nil
+}
+
+// newToolRegistry creates the tool registry described by cfg.
+func newToolRegistry(cfg Config, logger zerolog.Logger) (*tools.Registry, error) {
 	// Create tool registry
 	toolRegistry := tools.NewRegistry()
+	if cfg.CacheToolResults {
+		toolRegistry.SetResultCache(tools.NewResultCache())
+	}
 
 	// Register weather tool
-	weatherTool := weather.NewWeatherTool()
-	toolRegistry.Register(weatherTool)
-	log.Printf("Registered tool: %s", weatherTool.Name())
+	if !cfg.DisableWeatherTool {
+		weatherTool := weather.NewWeatherTool()
+		weatherTool.SetBaseURL(cfg.WeatherAPIURL)
+		if cfg.WeatherAmbiguityPolicy != "" {
+			weatherTool.SetAmbiguityPolicy(cfg.WeatherAmbiguityPolicy)
+		}
+		weatherTool.SetCacheTTL(cfg.WeatherCacheTTL)
+		breakerCooldown := cfg.WeatherBreakerCooldown
+		if breakerCooldown <= 0 {
+			breakerCooldown = 30 * time.Second
+		}
+		weatherTool.SetCircuitBreaker(cfg.WeatherBreakerThreshold, breakerCooldown)
+		toolRegistry.Register(weatherTool)
+		logger.Info().Str("tool", weatherTool.Name()).Msg("Registered tool")
+	}
+
+	// Register the embedder's tools
+	for _, tool := range cfg.Tools {
+		toolRegistry.Register(tool)
+		logger.Info().Str("tool", tool.Name()).Msg("Registered tool")
+	}
+	toolRegistry.Use(cfg.ToolMiddleware...)
+
+	// Apply per-tool cache TTLs
+	for name, ttl := range cfg.ToolCacheTTLs {
+		tool, exists := toolRegistry.Get(name)
+		if !exists {
+			return nil, fmt.Errorf("cached tool not registered: %q", name)
+		}
+		cacheable, ok := tool.(interface{ SetCacheTTL(time.Duration) })
+		if !ok {
+			return nil, fmt.Errorf("tool %q does not support caching", name)
+		}
+		cacheable.SetCacheTTL(ttl)
+	}
+
+	// Bound result sizes and concurrent tool calls
+	toolRegistry.SetMaxResultSize(cfg.MaxToolResultSize)
+	toolRegistry.SetConcurrencyLimit(cfg.MaxConcurrentToolCalls, cfg.ToolCallQueueTimeout)
+	for name, limit := range cfg.ToolConcurrencyLimits {
+		if _, exists := toolRegistry.Get(name); !exists {
+			return nil, fmt.Errorf("concurrency-limited tool not registered: %q", name)
+		}
+		toolRegistry.SetToolConcurrencyLimit(name, limit)
+	}
+
+	// Mark tools that may be called without a session
+	for _, name := range cfg.AnonymousTools {
+		tool, exists := toolRegistry.Get(name)
+		if !exists {
+			return nil, fmt.Errorf("anonymous tool not registered: %q", name)
+		}
+		anon, ok := tool.(interface{ SetAllowAnonymous(bool) })
+		if !ok {
+			return nil, fmt.Errorf("tool %q does not support anonymous calls", name)
+		}
+		anon.SetAllowAnonymous(true)
+	}
 
 	// List all registered tools for debugging
 	toolList := toolRegistry.List()
-	log.Printf("Total tools registered: %d", len(toolList))
+	logger.Info().Int("count", len(toolList)).Msg("Total tools registered")
 	for name, tool := range toolList {
-		log.Printf(" - %s (%T)", name, tool)
+		logger.Debug().Str("tool", name).Str("type", fmt.Sprintf("%T", tool)).Msg("Registered tool type")
 	}
+	return toolRegistry, nil
+}
 
-	// Create MCP handler
-	mcpHandler := mcp.NewHandler(toolRegistry)
+// auditCloser returns what must be closed once h stops recording tool
+// calls: its audit sink, if that is backed by a file.
+func auditCloser(h *mcp.Handler) io.Closer {
+	closer, _ := h.AuditSink().(io.Closer)
+	return closer
+}
+
+// Server is the HTTP handler returned by New. Close it when the server
+// stops serving, so its background work and open streams end with it.
+type Server struct {
+	http.Handler
+
+	mcp       *mcp.Handler
+	cancel    context.CancelFunc
+	stopped   func()
+	audit     io.Closer
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// EndStreams ends the server's open SSE streams and WebSocket connections,
+// which would otherwise hold up a graceful shutdown until its deadline.
+// Requests that are not streaming are unaffected, so it suits
+// http.Server.RegisterOnShutdown.
+func (s *Server) EndStreams() {
+	s.mcp.Close()
+}
+
+// Close ends open streams, stops the server's background work and waits for
+// it to finish, then closes the audit log file. Tool calls finishing after it
+// are not audited, so call it once the http.Server has shut down. Close is
+// safe to call more than once.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		s.EndStreams()
+		s.cancel()
+		s.stopped()
+		if s.audit != nil {
+			s.closeErr = s.audit.Close()
+		}
+	})
+	return s.closeErr
+}
+
+// New creates a new HTTP handler with the given configuration.
+func New(cfg Config, opts ...Option) (*Server, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	mcpHandler, err := NewMCPHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Background work stops on Close as well as when cfg.Context is done
+	ctx, cancel := context.WithCancel(cfg.context())
+
+	if cfg.SessionWebhookURL != "" {
+		mcpHandler.SetSessionWebhook(ctx, cfg.SessionWebhookURL)
+	}
+
+	idleTimeout := cfg.SessionIdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultSessionIdleTimeout
+	}
+	// Logged here rather than by the goroutines, which may outlive a
+	// caller's interest in the logger
+	logger := cfg.logger()
+	logger.Info().Dur("timeout", idleTimeout).Msg("Expiring idle sessions")
+	mcpHandler.SetSessionSweepJitter(cfg.SessionSweepJitter)
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		mcpHandler.ExpireIdleSessions(ctx, idleTimeout)
+	}()
+
+	if cfg.MetricsNotificationInterval > 0 {
+		logger.Info().Dur("interval", cfg.MetricsNotificationInterval).Msg("Starting metrics notifications")
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			mcpHandler.RunMetricsNotifications(ctx, cfg.MetricsNotificationInterval)
+		}()
+	}
+
+	apiKeyHeader := cfg.APIKeyHeader
+	if apiKeyHeader == "" {
+		apiKeyHeader = DefaultAPIKeyHeader
+	}
 
 	// Create router
 	r := chi.NewRouter()
 
 	// Add middleware
+	r.Use(capturePeer)
 	r.Use(middleware.RequestID)
+	r.Use(echoRequestID)
 	r.Use(middleware.RealIP)
+	r.Use(recordClientIP(proxies))
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Logger)
+	r.Use(accessLog(cfg.logger(), mcpHandler))
+	if cfg.RequestTimeout > 0 {
+		r.Use(requestTimeout(cfg.RequestTimeout))
+	}
+	if cfg.CompressResponses {
+		r.Use(compressExceptStreams(5))
+	}
 
 	// Enable CORS
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Weather-API-URL", "X-Weather-API-Key"},
-		ExposedHeaders:   []string{"Link", "Content-Type", "Cache-Control", "Connection"},
+		AllowedHeaders:   append([]string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Weather-API-URL", "X-Weather-API-Key", "Last-Event-ID", mcp.SessionIDHeader, apiKeyHeader, middleware.RequestIDHeader}, cfg.SessionHeaderAliases...),
+		ExposedHeaders:   []string{"Link", "Content-Type", "Cache-Control", "Connection", "Retry-After", mcp.SessionIDHeader, middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
-	// Serve static files from embedded filesystem
-	staticRoot, err := fs.Sub(staticFS, "web/static")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create sub filesystem: %w", err)
+	// Require an API key ahead of any session handling
+	if validate := cfg.APIKeyValidator; validate != nil || len(cfg.APIKeys) > 0 {
+		if validate == nil {
+			validate = KeySet(cfg.APIKeys)
+		}
+		exempt := cfg.APIKeyExemptPaths
+		if exempt == nil {
+			exempt = []string{"/health"}
+		}
+		r.Use(APIKeyAuth(apiKeyHeader, validate, exempt...))
 	}
 
 	// Add routes
@@ -108,14 +691,22 @@ func New(cfg Config) (http.Handler, error) {
 		w.Write([]byte("OK"))
 	})
 
+	// Build metadata
+	r.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, version.Get())
+	})
+
 	// IDE Configuration endpoint
 	r.Get("/.mcp/ide-config", func(w http.ResponseWriter, r *http.Request) {
-		baseURL := getBaseURL(r)
+		baseURL := getBaseURL(r, proxies)
+		if cfg.PublicBaseURL != "" {
+			baseURL = strings.TrimSuffix(cfg.PublicBaseURL, "/")
+		}
 		config := IDEConfig{
 			URL: baseURL + "/sse",
 			Headers: map[string]string{
-				"X-Weather-API-URL": "https://api.weatherapi.com/v1",
-				"X-Weather-API-Key":  "YOUR_TOKEN",
+				"X-Weather-API-URL": weather.DefaultAPIURL,
+				"X-Weather-API-Key": "YOUR_TOKEN",
 			},
 		}
 		render.JSON(w, r, map[string]interface{}{
@@ -123,23 +714,33 @@ func New(cfg Config) (http.Handler, error) {
 		})
 	})
 
-	// Configuration page
-	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
-		data, err := staticFS.ReadFile("web/static/config.xhtml")
-		if err != nil {
-			http.Error(w, "Configuration page not found", http.StatusNotFound)
-			return
+	// Configuration page and static files, unless running headless
+	if !cfg.DisableWebUI {
+		if err := mountWebUI(r); err != nil {
+			cancel()
+			if closer := auditCloser(mcpHandler); closer != nil {
+				closer.Close()
+			}
+			return nil, err
 		}
-		w.Header().Set("Content-Type", "application/xhtml+xml")
-		w.Write(data)
-	})
+	}
 
-	// Serve static files
-	fileServer(r, "/static", staticRoot)
+	// Runtime profiling, for diagnosing leaked streams and goroutines
+	if cfg.DebugPprof {
+		r.Mount("/debug", middleware.Profiler())
+	}
 
 	// Handle both GET and POST for MCP endpoint
 	r.Get("/sse", mcpHandler.Handle)
 	r.Post("/sse", mcpHandler.Handle)
 
-	return r, nil
+	// WebSocket transport
+	r.Get("/ws", mcpHandler.HandleWebSocket)
+
+	// Streamable HTTP transport
+	r.Get("/mcp", mcpHandler.HandleStreamable)
+	r.Post("/mcp", mcpHandler.HandleStreamable)
+	r.Delete("/mcp", mcpHandler.HandleStreamable)
+
+	return &Server{Handler: r, mcp: mcpHandler, cancel: cancel, stopped: background.Wait, audit: auditCloser(mcpHandler)}, nil
 }
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+func TestShutdownStopsGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	// No Context, so only Close can stop the background work
+	logger := zerolog.Nop()
+	handler, err := New(Config{
+		Logger:                      &logger,
+		DisableWeatherTool:          true,
+		MetricsNotificationInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := &http.Server{Handler: handler}
+	httpServer.RegisterOnShutdown(handler.EndStreams)
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		httpServer.Serve(ln)
+	}()
+
+	// An open stream would hold up Shutdown until its deadline
+	client := &http.Client{Transport: &http.Transport{}}
+	req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event: endpoint") {
+		t.Fatalf("first line = %q, %v; want the endpoint event", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Shutdown took %v with an open stream", elapsed)
+	}
+	<-served
+	if err := handler.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutines = %d after shutdown, want %d\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseClosesAuditLog(t *testing.T) {
+	logger := zerolog.Nop()
+	handler, err := New(Config{
+		Logger:             &logger,
+		DisableWeatherTool: true,
+		AuditLog:           filepath.Join(t.TempDir(), "audit.log"),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := handler.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := handler.audit.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("closing the audit log again = %v, want it already closed", err)
+	}
+	// Close is idempotent
+	if err := handler.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+// sseEndpoint opens an SSE stream on srv as if forwarded for
+// mcp.example.com and returns the endpoint it announces.
+func sseEndpoint(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/sse", nil)
+	req.Host = "internal:8080"
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "mcp.example.com")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "event: endpoint\n" {
+		t.Fatalf("first line = %q, %v; want the endpoint event", line, err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+}
+
+func TestPublicBaseURLOverridesRequest(t *testing.T) {
+	newServer := func(publicBaseURL string) *Server {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		logger := zerolog.Nop()
+		handler, err := New(Config{
+			Logger:             &logger,
+			Context:            ctx,
+			DisableWeatherTool: true,
+			PublicBaseURL:      publicBaseURL,
+			TrustedProxies:     []string{"127.0.0.1", "192.0.2.1"},
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { handler.Close() })
+		return handler
+	}
+	forwarded := map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "mcp.example.com",
+	}
+
+	handler := newServer("https://public.example.com/")
+	if got := ideConfigURL(t, handler, "192.0.2.1:1234", forwarded); got != "https://public.example.com/sse" {
+		t.Errorf("ide-config URL = %q, want it under the public base URL", got)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	if got := sseEndpoint(t, srv); !strings.HasPrefix(got, "https://public.example.com/sse?sessionId=") {
+		t.Errorf("endpoint = %q, want it under the public base URL", got)
+	}
+
+	// Without the override the URL comes from the request
+	handler = newServer("")
+	if got := ideConfigURL(t, handler, "192.0.2.1:1234", forwarded); got != "https://mcp.example.com/sse" {
+		t.Errorf("ide-config URL = %q, want the forwarded host", got)
+	}
+	srv = httptest.NewServer(handler)
+	defer srv.Close()
+	if got := sseEndpoint(t, srv); !strings.HasPrefix(got, "/sse?sessionId=") {
+		t.Errorf("endpoint = %q, want a relative path", got)
+	}
+}
+
+func TestDisableWebUI(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		logger := zerolog.Nop()
+		handler, err := New(Config{
+			Logger:             &logger,
+			Context:            ctx,
+			DisableWeatherTool: true,
+			DisableWebUI:       disabled,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { handler.Close() })
+
+		want := http.StatusOK
+		if disabled {
+			want = http.StatusNotFound
+		}
+		for _, path := range []string{"/config", "/static/config.xhtml"} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != want {
+				t.Errorf("DisableWebUI %v: %s status = %d, want %d", disabled, path, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestRequestIDEchoedAndLogged(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := New(Config{
+		Logger:             &logger,
+		Context:            ctx,
+		DisableWeatherTool: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get(middleware.RequestIDHeader); got != "req-42" {
+		t.Fatalf("%s = %q, want req-42", middleware.RequestIDHeader, got)
+	}
+
+	// The MCP handler's own lines carry the id, not just the access log
+	var tagged bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", line, err)
+		}
+		if entry["component"] == "mcp_handler" && entry["request_id"] == "req-42" {
+			tagged = true
+		}
+	}
+	if !tagged {
+		t.Fatalf("no MCP handler log line has request_id req-42:\n%s", logs.String())
+	}
+
+	// Without one from the client, the generated id is echoed
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Header().Get(middleware.RequestIDHeader) == "" {
+		t.Fatalf("%s missing from a request without one", middleware.RequestIDHeader)
+	}
+}
+
+func TestDebugPprof(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		logger := zerolog.Nop()
+		handler, err := New(Config{
+			Logger:             &logger,
+			Context:            ctx,
+			DisableWeatherTool: true,
+			DebugPprof:         enabled,
+		})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { handler.Close() })
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1"} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != want {
+				t.Errorf("DebugPprof %v: %s status = %d, want %d", enabled, path, rec.Code, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+// requestTimeout returns middleware that gives each request a deadline of d.
+// Streams are exempt, as they are meant to stay open. Like
+// http.TimeoutHandler, the handler runs in its own goroutine and writes to a
+// buffer, so a request that runs out of time is answered with 503 and a
+// JSON-RPC error as soon as the deadline passes, even if the handler ignores
+// its context. Whatever the handler wrote is discarded.
+func requestTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				// A client that went away needs no answer
+				if ctx.Err() == context.DeadlineExceeded {
+					writeTimeout(w)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler returns. Once the
+// request has timed out, writes fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+// Flush is a no-op: the response is sent in one piece when the handler
+// returns. It lets handlers that frame their answer as an event stream run
+// under the deadline.
+func (tw *timeoutWriter) Flush() {}
+
+// writeTimeout answers a request that ran out of time.
+func writeTimeout(w http.ResponseWriter) {
+	resp := &jsonrpc.Response{
+		JSONRPC: jsonrpc.Version,
+		Error:   jsonrpc.NewTimeoutError(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/jsonrpc"
+)
+
+func TestRequestTimeoutAnswersSlowHandler(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("too late"))
+		}
+	})
+	handler := requestTimeout(50 * time.Millisecond)(slow)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request took %v, want the timeout to fire", elapsed)
+	}
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var resp struct {
+		Error struct {
+			Code int               `json:"code"`
+			Data jsonrpc.ErrorData `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body, err)
+	}
+	if resp.Error.Data.Type != jsonrpc.ErrorTypeTimeout || !resp.Error.Data.Retryable {
+		t.Fatalf("error = %+v, want a retryable timeout", resp.Error)
+	}
+}
+
+func TestRequestTimeoutAnswersHandlerIgnoringContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stuck := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("too late"))
+	})
+	handler := requestTimeout(50 * time.Millisecond)(stuck)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+		done <- rec
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the timeout response waited for the stuck handler")
+	}
+}
+
+func TestRequestTimeoutPassesResponseThrough(t *testing.T) {
+	handler := requestTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if rec.Code != http.StatusAccepted || rec.Body.String() != "{}" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("response = %d %q %v, want the handler's own", rec.Code, rec.Body, rec.Header())
+	}
+}
+
+func TestRequestTimeoutExemptsStreams(t *testing.T) {
+	var deadline bool
+	handler := requestTimeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, deadline = r.Context().Deadline()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if deadline {
+		t.Fatal("stream request was given a deadline")
+	}
+}
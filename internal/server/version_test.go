@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/version"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	orig := version.Get()
+	defer func() {
+		version.Version, version.Commit, version.BuildTime = orig.Version, orig.Commit, orig.BuildTime
+	}()
+	// As if injected with -ldflags
+	version.Version, version.Commit, version.BuildTime = "1.2.3", "abc1234", "2026-10-15T12:00:00Z"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := zerolog.Nop()
+	handler, err := New(Config{
+		Logger:             &logger,
+		Context:            ctx,
+		DisableWeatherTool: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { handler.Close() })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body, err)
+	}
+	want := map[string]string{"version": "1.2.3", "commit": "abc1234", "buildTime": "2026-10-15T12:00:00Z"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
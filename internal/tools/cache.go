@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the number of results a ResultCache holds.
+const maxCacheEntries = 1024
+
+// Cacheable is implemented by tools whose results depend only on their
+// arguments, and on their CacheScope if they are also CacheScopers. A
+// positive CacheTTL opts the tool into result caching.
+type Cacheable interface {
+	CacheTTL() time.Duration
+}
+
+// CacheScoper is implemented by Cacheable tools whose results also depend on
+// request-specific inputs carried in the context, such as credentials or an
+// upstream URL. CacheScope returns a string identifying those inputs, which
+// becomes part of the cache key, or false if the call must not be cached.
+type CacheScoper interface {
+	CacheScope(ctx context.Context) (string, bool)
+}
+
+// cacheEntry is a cached tool result and the time it stops being valid.
+type cacheEntry struct {
+	result    json.RawMessage
+	expiresAt time.Time
+}
+
+// ResultCache caches successful results of Cacheable tools, keyed by tool
+// name and normalized arguments.
+type ResultCache struct {
+	entries map[string]cacheEntry
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+// NewResultCache creates an empty result cache.
+func NewResultCache() *ResultCache {
+	return &ResultCache{
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached result for key if it has not expired.
+func (c *ResultCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// set stores result under key for ttl. When the cache is full, expired
+// entries are purged first; if it is still full the result is not cached.
+func (c *ResultCache) set(key string, result json.RawMessage, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		result:    result,
+		expiresAt: now.Add(ttl),
+	}
+}
+
+// cacheKey builds the cache key for a call from the tool name, the
+// canonical form of its arguments and, for CacheScoper tools, their scope.
+func cacheKey(ctx context.Context, tool Tool, args json.RawMessage) (string, bool) {
+	canonical, err := CanonicalJSON(args)
+	if err != nil {
+		return "", false
+	}
+
+	scope := ""
+	if scoper, ok := tool.(CacheScoper); ok {
+		if scope, ok = scoper.CacheScope(ctx); !ok {
+			return "", false
+		}
+	}
+	return tool.Name() + "\x00" + scope + "\x00" + string(canonical), true
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCachedResultExpiresAfterTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := NewResultCache()
+	cache.now = func() time.Time { return now }
+
+	r := NewRegistry()
+	r.SetResultCache(cache)
+	tool := newCountingTool(time.Minute)
+	r.Register(tool)
+
+	call := func(args string) {
+		t.Helper()
+		if _, err := r.Call(context.Background(), "count", json.RawMessage(args)); err != nil {
+			t.Fatalf("Call(%s): %v", args, err)
+		}
+	}
+
+	call(`{"city":"Paris","units":"metric"}`)
+	// Arguments that differ only in key order hit the same entry
+	now = now.Add(59 * time.Second)
+	call(`{"units":"metric","city":"Paris"}`)
+	if n := tool.calls.Load(); n != 1 {
+		t.Fatalf("the tool ran %d times within the TTL, want 1", n)
+	}
+
+	now = now.Add(time.Second)
+	call(`{"city":"Paris","units":"metric"}`)
+	if n := tool.calls.Load(); n != 2 {
+		t.Fatalf("the tool ran %d times after the TTL, want 2", n)
+	}
+}
+
+func TestZeroTTLIsNotCached(t *testing.T) {
+	r := NewRegistry()
+	r.SetResultCache(NewResultCache())
+	tool := newCountingTool(0)
+	r.Register(tool)
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Call(context.Background(), "count", json.RawMessage(`{}`)); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if n := tool.calls.Load(); n != 2 {
+		t.Fatalf("the tool ran %d times, want 2", n)
+	}
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// CanonicalJSON returns a canonical encoding of data: object keys sorted,
+// insignificant whitespace removed and numbers kept exactly as written.
+// Semantically equal argument blobs therefore produce identical bytes, which
+// makes the result suitable as a cache or idempotency key. Empty input is
+// treated as JSON null.
+func CanonicalJSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid JSON: trailing data after value")
+	}
+
+	// encoding/json writes map keys in sorted order
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
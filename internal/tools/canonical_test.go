@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCanonicalJSONEqualArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "key order", a: `{"city":"Paris","units":"metric"}`, b: `{"units":"metric","city":"Paris"}`},
+		{name: "whitespace", a: `{"city":"Paris"}`, b: " {\n\t\"city\" : \"Paris\"\n} "},
+		{name: "nested", a: `{"at":{"lat":1,"lon":2},"tags":["a","b"]}`, b: `{"tags":["a","b"],"at":{"lon":2,"lat":1}}`},
+		{name: "empty", a: ``, b: `null`},
+	}
+	for _, tt := range tests {
+		a, err := CanonicalJSON(json.RawMessage(tt.a))
+		if err != nil {
+			t.Fatalf("%s: CanonicalJSON(%s): %v", tt.name, tt.a, err)
+		}
+		b, err := CanonicalJSON(json.RawMessage(tt.b))
+		if err != nil {
+			t.Fatalf("%s: CanonicalJSON(%s): %v", tt.name, tt.b, err)
+		}
+		if string(a) != string(b) {
+			t.Errorf("%s: %s and %s differ", tt.name, a, b)
+		}
+	}
+}
+
+func TestCanonicalJSONDistinctArguments(t *testing.T) {
+	// Array order and the exact form of numbers are significant
+	for _, pair := range [][2]string{
+		{`["a","b"]`, `["b","a"]`},
+		{`{"n":12345678901234567890}`, `{"n":12345678901234567891}`},
+		{`{"city":"Paris"}`, `{"city":"paris"}`},
+	} {
+		a, err := CanonicalJSON(json.RawMessage(pair[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := CanonicalJSON(json.RawMessage(pair[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(a) == string(b) {
+			t.Errorf("%s and %s share the canonical form %s", pair[0], pair[1], a)
+		}
+	}
+}
+
+func TestCanonicalJSONRejectsInvalid(t *testing.T) {
+	for _, data := range []string{`{"city":`, `{} {}`} {
+		if _, err := CanonicalJSON(json.RawMessage(data)); err == nil {
+			t.Errorf("CanonicalJSON(%s) succeeded, want an error", data)
+		}
+	}
+}
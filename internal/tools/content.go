@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Content types of MCP content blocks.
+const (
+	ContentTypeText     = "text"
+	ContentTypeImage    = "image"
+	ContentTypeAudio    = "audio"
+	ContentTypeResource = "resource"
+)
+
+// Content is one block of a tool result's content array.
+type Content struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+}
+
+// EmbeddedResource is the payload of a resource content block. Exactly one
+// of Text and Blob is set; Blob is base64-encoded.
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Result is the MCP result of a tools/call.
+type Result struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// TextContent returns a text content block.
+func TextContent(text string) Content {
+	return Content{Type: ContentTypeText, Text: text}
+}
+
+// ImageContent returns an image content block carrying data base64-encoded.
+func ImageContent(data []byte, mimeType string) Content {
+	return Content{Type: ContentTypeImage, Data: base64.StdEncoding.EncodeToString(data), MimeType: mimeType}
+}
+
+// AudioContent returns an audio content block carrying data base64-encoded.
+func AudioContent(data []byte, mimeType string) Content {
+	return Content{Type: ContentTypeAudio, Data: base64.StdEncoding.EncodeToString(data), MimeType: mimeType}
+}
+
+// TextResourceContent returns a resource content block embedding text.
+func TextResourceContent(uri, mimeType, text string) Content {
+	return Content{Type: ContentTypeResource, Resource: &EmbeddedResource{URI: uri, MimeType: mimeType, Text: text}}
+}
+
+// BlobResourceContent returns a resource content block embedding binary
+// data base64-encoded, e.g. a generated file.
+func BlobResourceContent(uri, mimeType string, data []byte) Content {
+	return Content{Type: ContentTypeResource, Resource: &EmbeddedResource{
+		URI:      uri,
+		MimeType: mimeType,
+		Blob:     base64.StdEncoding.EncodeToString(data),
+	}}
+}
+
+// Validate reports whether c has the fields its type requires.
+func (c Content) Validate() error {
+	switch c.Type {
+	case ContentTypeText:
+		return nil
+	case ContentTypeImage, ContentTypeAudio:
+		if c.MimeType == "" {
+			return fmt.Errorf("%s content requires mimeType", c.Type)
+		}
+		if _, err := base64.StdEncoding.DecodeString(c.Data); err != nil {
+			return fmt.Errorf("%s content data is not base64: %w", c.Type, err)
+		}
+		return nil
+	case ContentTypeResource:
+		if c.Resource == nil || c.Resource.URI == "" {
+			return fmt.Errorf("resource content requires a resource with a uri")
+		}
+		if (c.Resource.Text == "") == (c.Resource.Blob == "") {
+			return fmt.Errorf("resource %s must have exactly one of text and blob", c.Resource.URI)
+		}
+		if _, err := base64.StdEncoding.DecodeString(c.Resource.Blob); err != nil {
+			return fmt.Errorf("resource %s blob is not base64: %w", c.Resource.URI, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown content type: %q", c.Type)
+	}
+}
+
+// validateResult checks the content array of a tool's JSON result.
+func validateResult(result json.RawMessage) error {
+	var r struct {
+		Content *[]Content `json:"content"`
+	}
+	if err := json.Unmarshal(result, &r); err != nil {
+		return fmt.Errorf("result is not a JSON object: %w", err)
+	}
+	if r.Content == nil {
+		return fmt.Errorf("result has no content array")
+	}
+	for i, c := range *r.Content {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("content[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// isErrorResult reports whether result is a tool result with isError set.
+func isErrorResult(result json.RawMessage) bool {
+	var r struct {
+		IsError bool `json:"isError"`
+	}
+	return json.Unmarshal(result, &r) == nil && r.IsError
+}
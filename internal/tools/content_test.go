@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// chartTool returns a fixed result, such as a rendered chart.
+type chartTool struct {
+	*DefaultTool
+	result Result
+}
+
+func (t *chartTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	return json.Marshal(t.result)
+}
+
+func TestImageContentThroughRegistry(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nchart")
+	r := NewRegistry()
+	r.Register(&chartTool{NewDefaultTool("chart", "Draws a chart"), Result{Content: []Content{
+		TextContent("Temperature this week"),
+		ImageContent(png, "image/png"),
+	}}})
+
+	raw, err := r.Call(context.Background(), "chart", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var result struct {
+		Content []map[string]string `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode %s: %v", raw, err)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("content = %s, want two blocks", raw)
+	}
+	image := result.Content[1]
+	if image["type"] != "image" || image["mimeType"] != "image/png" {
+		t.Fatalf("image block = %v, want type image with its mimeType", image)
+	}
+	data, err := base64.StdEncoding.DecodeString(image["data"])
+	if err != nil || string(data) != string(png) {
+		t.Fatalf("image data = %q, want the PNG base64-encoded", image["data"])
+	}
+}
+
+func TestInvalidContentRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content Content
+	}{
+		{name: "image without mimeType", content: Content{Type: ContentTypeImage, Data: "AAAA"}},
+		{name: "image data not base64", content: Content{Type: ContentTypeImage, Data: "not base64!", MimeType: "image/png"}},
+		{name: "resource with text and blob", content: Content{Type: ContentTypeResource, Resource: &EmbeddedResource{URI: "file:///a", Text: "a", Blob: "AAAA"}}},
+		{name: "unknown type", content: Content{Type: "video"}},
+	}
+	for _, tt := range tests {
+		r := NewRegistry()
+		r.Register(&chartTool{NewDefaultTool("chart", "Draws a chart"), Result{Content: []Content{tt.content}}})
+
+		_, err := r.Call(context.Background(), "chart", json.RawMessage(`{}`))
+		var toolErr *Error
+		if !errors.As(err, &toolErr) || toolErr.Code != ErrCodeInvalidResult {
+			t.Errorf("%s: error = %v, want an invalid result error", tt.name, err)
+		}
+	}
+
+	for _, c := range []Content{
+		TextResourceContent("file:///notes.txt", "text/plain", "notes"),
+		BlobResourceContent("file:///chart.png", "image/png", []byte("chart")),
+		AudioContent([]byte("wav"), "audio/wav"),
+	} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%+v: Validate = %v, want valid", c, err)
+		}
+	}
+}
@@ -4,20 +4,106 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // DefaultTool is a base implementation of the Tool interface that can be embedded in other tools.
 type DefaultTool struct {
 	name        string
+	title       string
 	description string
+
+	// MCP behavior hints; nil hints are omitted so clients apply the spec defaults
+	readOnlyHint    *bool
+	destructiveHint *bool
+	idempotentHint  *bool
+	openWorldHint   *bool
+
+	// outputSchema describes the result's structuredContent; nil omits it
+	outputSchema map[string]any
+
+	allowAnonymous bool
+	cacheTTL       time.Duration
 }
 
 // NewDefaultTool creates a new DefaultTool with the given name and description.
+// Tools are assumed to talk to external services, so openWorldHint starts true.
 func NewDefaultTool(name, description string) *DefaultTool {
+	openWorld := true
 	return &DefaultTool{
-		name:        name,
-		description: description,
+		name:          name,
+		description:   description,
+		openWorldHint: &openWorld,
+	}
+}
+
+// SetTitle sets the human-friendly title shown by clients. Without one the
+// title is derived from the tool name.
+func (t *DefaultTool) SetTitle(title string) {
+	t.title = title
+}
+
+// SetDescription replaces the description given to NewDefaultTool.
+func (t *DefaultTool) SetDescription(description string) {
+	t.description = description
+}
+
+// Title returns the tool's title, falling back to "<name> Tool".
+func (t *DefaultTool) Title() string {
+	if t.title != "" {
+		return t.title
 	}
+	return fmt.Sprintf("%s Tool", t.name)
+}
+
+// SetOutputSchema sets the JSON Schema of the structuredContent the tool
+// returns. Tools that declare one must include conforming structuredContent
+// in every successful result.
+func (t *DefaultTool) SetOutputSchema(schema map[string]any) {
+	t.outputSchema = schema
+}
+
+// SetAllowAnonymous declares whether the tool may be called without a session.
+func (t *DefaultTool) SetAllowAnonymous(v bool) {
+	t.allowAnonymous = v
+}
+
+// AllowAnonymous implements AnonymousCallable.
+func (t *DefaultTool) AllowAnonymous() bool {
+	return t.allowAnonymous
+}
+
+// SetCacheTTL sets how long results are cached when the registry has a
+// result cache. Zero, the default, disables caching for this tool. Only
+// tools whose results depend solely on their arguments should set it.
+func (t *DefaultTool) SetCacheTTL(ttl time.Duration) {
+	t.cacheTTL = ttl
+}
+
+// CacheTTL implements Cacheable.
+func (t *DefaultTool) CacheTTL() time.Duration {
+	return t.cacheTTL
+}
+
+// SetReadOnlyHint declares whether the tool leaves its environment unmodified.
+func (t *DefaultTool) SetReadOnlyHint(v bool) {
+	t.readOnlyHint = &v
+}
+
+// SetDestructiveHint declares whether the tool may perform destructive updates.
+func (t *DefaultTool) SetDestructiveHint(v bool) {
+	t.destructiveHint = &v
+}
+
+// SetIdempotentHint declares whether repeating a call with the same arguments
+// has no additional effect.
+func (t *DefaultTool) SetIdempotentHint(v bool) {
+	t.idempotentHint = &v
+}
+
+// SetOpenWorldHint declares whether the tool interacts with external entities.
+func (t *DefaultTool) SetOpenWorldHint(v bool) {
+	t.openWorldHint = &v
 }
 
 // Name returns the name of the tool.
@@ -33,13 +119,10 @@ func (t *DefaultTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 
 // GetToolDefinition returns the default tool definition in MCP format.
 func (t *DefaultTool) GetToolDefinition() map[string]any {
-	return map[string]any{
+	def := map[string]any{
 		"name":        t.name,
 		"description": t.description,
-		"annotations": map[string]any{
-			"title":         fmt.Sprintf("%s Tool", t.name),
-			"openWorldHint": true,
-		},
+		"annotations": t.annotations(),
 		"inputSchema": map[string]any{
 			"type": "object",
 			"properties": map[string]any{
@@ -51,4 +134,28 @@ func (t *DefaultTool) GetToolDefinition() map[string]any {
 			"required": []string{"input"},
 		},
 	}
+	if t.outputSchema != nil {
+		def["outputSchema"] = t.outputSchema
+	}
+	return def
+}
+
+// annotations builds the MCP annotations object, including only the hints
+// that have been set.
+func (t *DefaultTool) annotations() map[string]any {
+	annotations := map[string]any{
+		"title": t.Title(),
+	}
+	hints := map[string]*bool{
+		"readOnlyHint":    t.readOnlyHint,
+		"destructiveHint": t.destructiveHint,
+		"idempotentHint":  t.idempotentHint,
+		"openWorldHint":   t.openWorldHint,
+	}
+	for key, hint := range hints {
+		if hint != nil {
+			annotations[key] = *hint
+		}
+	}
+	return annotations
 }
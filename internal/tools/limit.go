@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// semaphore bounds the number of concurrent tool calls.
+type semaphore chan struct{}
+
+// acquire takes a slot, waiting up to wait for one to free up. A zero wait
+// fails immediately when the semaphore is full.
+func (s semaphore) acquire(ctx context.Context, wait time.Duration) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case s <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return &Error{Code: ErrCodeBusy, Message: "Too many concurrent tool calls", Retryable: true}
+}
+
+// release frees a slot taken by acquire.
+func (s semaphore) release() {
+	<-s
+}
+
+// SetConcurrencyLimit bounds how many tool calls run at once across all
+// tools. Calls beyond the limit wait up to wait for a slot and then fail
+// with ErrCodeBusy. A limit of zero or less removes the bound.
+func (r *Registry) SetConcurrencyLimit(limit int, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.limit = nil
+	if limit > 0 {
+		r.limit = make(semaphore, limit)
+	}
+	r.limitWait = wait
+}
+
+// SetToolConcurrencyLimit bounds how many calls of the named tool run at
+// once, in addition to any global limit. A limit of zero or less removes
+// the bound.
+func (r *Registry) SetToolConcurrencyLimit(name string, limit int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.toolLimits, name)
+	if limit > 0 {
+		r.toolLimits[name] = make(semaphore, limit)
+	}
+}
+
+// invoke calls tool while holding a slot in the
+// global and per-tool limits, and checks the shape of its result.
+func (r *Registry) invoke(ctx context.Context, tool Tool, args json.RawMessage) (json.RawMessage, error) {
+	r.mu.RLock()
+	global, perTool, wait := r.limit, r.toolLimits[tool.Name()], r.limitWait
+	maxSize := r.maxResultSize
+	r.mu.RUnlock()
+
+	for _, sem := range []semaphore{perTool, global} {
+		if sem == nil {
+			continue
+		}
+		if err := sem.acquire(ctx, wait); err != nil {
+			return nil, err
+		}
+		defer sem.release()
+	}
+
+	result, err := tool.Call(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && len(result) > maxSize {
+		return nil, &Error{Code: ErrCodeResultTooLarge, Message: fmt.Sprintf("tool %s returned %d bytes, more than the %d allowed", tool.Name(), len(result), maxSize)}
+	}
+	if err := validateResult(result); err != nil {
+		return nil, &Error{Code: ErrCodeInvalidResult, Message: fmt.Sprintf("tool %s returned an invalid result: %v", tool.Name(), err)}
+	}
+	return result, nil
+}
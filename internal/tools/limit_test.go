@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingTool holds each call until release is closed, signalling on
+// started as calls begin.
+type blockingTool struct {
+	*DefaultTool
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTool(name string) *blockingTool {
+	return &blockingTool{
+		DefaultTool: NewDefaultTool(name, "Blocks until released"),
+		started:     make(chan struct{}, 16),
+		release:     make(chan struct{}),
+	}
+}
+
+func (t *blockingTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	t.started <- struct{}{}
+	<-t.release
+	return json.Marshal(Result{Content: []Content{TextContent("done")}})
+}
+
+// startCall calls tool in the background and returns its error channel,
+// once the tool has started running.
+func startCall(t *testing.T, r *Registry, tool *blockingTool) <-chan error {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.Call(context.Background(), tool.Name(), json.RawMessage(`{}`))
+		errs <- err
+	}()
+	select {
+	case <-tool.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("call did not start")
+	}
+	return errs
+}
+
+// isBusy reports whether err is the concurrency limit's busy error.
+func isBusy(err error) bool {
+	var toolErr *Error
+	return errors.As(err, &toolErr) && toolErr.Code == ErrCodeBusy && toolErr.Retryable
+}
+
+func TestConcurrencyLimitRejects(t *testing.T) {
+	r := NewRegistry()
+	tool := newBlockingTool("slow")
+	r.Register(tool)
+	r.SetConcurrencyLimit(1, 0)
+
+	first := startCall(t, r, tool)
+	_, err := r.Call(context.Background(), "slow", json.RawMessage(`{}`))
+	if !isBusy(err) {
+		t.Fatalf("call over the limit returned %v, want a busy error", err)
+	}
+
+	close(tool.release)
+	if err := <-first; err != nil {
+		t.Fatalf("first call failed: %v", err)
+	}
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	r := NewRegistry()
+	tool := newBlockingTool("slow")
+	r.Register(tool)
+	r.SetConcurrencyLimit(1, 2*time.Second)
+
+	first := startCall(t, r, tool)
+	second := make(chan error, 1)
+	go func() {
+		_, err := r.Call(context.Background(), "slow", json.RawMessage(`{}`))
+		second <- err
+	}()
+
+	// The second call waits for the slot instead of running
+	select {
+	case <-tool.started:
+		t.Fatal("second call ran while the limit was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(tool.release)
+	for _, errs := range []<-chan error{first, second} {
+		if err := <-errs; err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+}
+
+func TestConcurrencyLimitWaitEnds(t *testing.T) {
+	r := NewRegistry()
+	tool := newBlockingTool("slow")
+	r.Register(tool)
+	r.SetConcurrencyLimit(1, 20*time.Millisecond)
+	defer close(tool.release)
+
+	startCall(t, r, tool)
+	if _, err := r.Call(context.Background(), "slow", json.RawMessage(`{}`)); !isBusy(err) {
+		t.Fatalf("call after waiting returned %v, want a busy error", err)
+	}
+}
+
+func TestConcurrencyLimitWaitCancelled(t *testing.T) {
+	r := NewRegistry()
+	tool := newBlockingTool("slow")
+	r.Register(tool)
+	r.SetConcurrencyLimit(1, time.Minute)
+	defer close(tool.release)
+
+	startCall(t, r, tool)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.Call(ctx, "slow", json.RawMessage(`{}`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call returned %v, want the context's error", err)
+	}
+}
+
+func TestToolConcurrencyLimit(t *testing.T) {
+	r := NewRegistry()
+	slow := newBlockingTool("slow")
+	other := newBlockingTool("other")
+	r.Register(slow)
+	r.Register(other)
+	r.SetToolConcurrencyLimit("slow", 1)
+	defer close(slow.release)
+	defer close(other.release)
+
+	startCall(t, r, slow)
+	if _, err := r.Call(context.Background(), "slow", json.RawMessage(`{}`)); !isBusy(err) {
+		t.Fatalf("second slow call returned %v, want a busy error", err)
+	}
+
+	// Other tools are not bound by the per-tool limit
+	startCall(t, r, other)
+}
@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ToolMiddleware wraps a tool to add behavior around its Call, such as
+// logging or validation. Middleware is applied on each call, so it also
+// covers tools registered after Use, and it runs outside the result cache,
+// so it sees cached results too.
+type ToolMiddleware func(Tool) Tool
+
+// CallFunc has the signature of Tool.Call.
+type CallFunc func(ctx context.Context, args json.RawMessage) (json.RawMessage, error)
+
+// wrappedTool replaces the Call of the tool it embeds.
+type wrappedTool struct {
+	Tool
+	call CallFunc
+}
+
+func (t *wrappedTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	return t.call(ctx, args)
+}
+
+// WrapCall returns a tool that behaves like tool but runs call instead of
+// tool.Call. It is the usual way to write a ToolMiddleware.
+func WrapCall(tool Tool, call CallFunc) Tool {
+	return &wrappedTool{Tool: tool, call: call}
+}
+
+// Use appends middleware to the chain run around every tool call. The
+// first middleware added is the outermost.
+func (r *Registry) Use(middleware ...ToolMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// wrap applies the middleware chain to tool.
+func (r *Registry) wrap(tool Tool) Tool {
+	r.mu.RLock()
+	middleware := r.middleware
+	r.mu.RUnlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		tool = middleware[i](tool)
+	}
+	return tool
+}
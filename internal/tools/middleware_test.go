@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTool echoes its arguments and counts how often it is called.
+type countingTool struct {
+	*DefaultTool
+	calls atomic.Int32
+}
+
+func newCountingTool(ttl time.Duration) *countingTool {
+	tool := &countingTool{DefaultTool: NewDefaultTool("count", "Counts its calls")}
+	tool.SetCacheTTL(ttl)
+	return tool
+}
+
+func (t *countingTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	t.calls.Add(1)
+	return json.Marshal(Result{Content: []Content{TextContent(string(args))}})
+}
+
+// recordingMiddleware appends name to calls before and after the call.
+func recordingMiddleware(name string, calls *[]string) ToolMiddleware {
+	return func(tool Tool) Tool {
+		return WrapCall(tool, func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+			*calls = append(*calls, name+" before")
+			result, err := tool.Call(ctx, args)
+			*calls = append(*calls, name+" after")
+			return result, err
+		})
+	}
+}
+
+func TestMiddlewareRunsInOrderOnCacheHit(t *testing.T) {
+	r := NewRegistry()
+	r.SetResultCache(NewResultCache())
+	tool := newCountingTool(time.Minute)
+	r.Register(tool)
+
+	var calls []string
+	r.Use(recordingMiddleware("first", &calls), recordingMiddleware("second", &calls))
+
+	want := "[first before second before second after first after]"
+	for i, call := range []string{"miss", "hit"} {
+		calls = nil
+		if _, err := r.Call(context.Background(), "count", json.RawMessage(`{}`)); err != nil {
+			t.Fatalf("%s: Call: %v", call, err)
+		}
+		if fmt.Sprint(calls) != want {
+			t.Fatalf("%s: middleware ran as %v, want %s", call, calls, want)
+		}
+		if n := tool.calls.Load(); n != 1 {
+			t.Fatalf("after call %d the tool ran %d times, want 1", i+1, n)
+		}
+	}
+}
+
+// failingTool is a countingTool whose results report a failure.
+type failingTool struct {
+	*countingTool
+}
+
+func (t failingTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	t.calls.Add(1)
+	return json.Marshal(Result{Content: []Content{TextContent("failed")}, IsError: true})
+}
+
+func TestErrorResultsAreNotCached(t *testing.T) {
+	r := NewRegistry()
+	r.SetResultCache(NewResultCache())
+	tool := failingTool{newCountingTool(time.Minute)}
+	r.Register(tool)
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Call(context.Background(), "count", json.RawMessage(`{}`)); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if n := tool.calls.Load(); n != 2 {
+		t.Fatalf("the tool ran %d times, want 2", n)
+	}
+}
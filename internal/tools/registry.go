@@ -3,19 +3,35 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Registry manages the collection of available tools.
 type Registry struct {
 	tools map[string]Tool
+	cache *ResultCache
 	mu    sync.RWMutex
+
+	// Concurrency limits; see SetConcurrencyLimit
+	limit      semaphore
+	limitWait  time.Duration
+	toolLimits map[string]semaphore
+
+	middleware []ToolMiddleware
+
+	// maxResultSize bounds a result's serialized size; zero means no bound
+	maxResultSize int
 }
 
 // NewRegistry creates a new tool registry.
 func NewRegistry() *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:      make(map[string]Tool),
+		toolLimits: make(map[string]semaphore),
 	}
 }
 
@@ -27,6 +43,24 @@ func (r *Registry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// SetResultCache enables result caching for Cacheable tools. A nil cache
+// disables it.
+func (r *Registry) SetResultCache(cache *ResultCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache = cache
+}
+
+// SetMaxResultSize rejects tool results larger than size bytes of JSON with
+// ErrCodeResultTooLarge. Zero or less removes the bound.
+func (r *Registry) SetMaxResultSize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxResultSize = size
+}
+
 // Get returns a tool by name.
 func (r *Registry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
@@ -48,22 +82,107 @@ func (r *Registry) List() map[string]Tool {
 	return tools
 }
 
+// Sorted returns all registered tools ordered by name, for listings that
+// must be stable across calls.
+func (r *Registry) Sorted() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name() < tools[j].Name()
+	})
+	return tools
+}
+
 // Call executes a tool with the given arguments and context.
 func (r *Registry) Call(ctx context.Context, toolName string, args json.RawMessage) (json.RawMessage, error) {
 	tool, exists := r.Get(toolName)
 	if !exists {
-		return nil, &Error{Code: "tool_not_found", Message: "Tool not found"}
+		return nil, &Error{Code: ErrCodeToolNotFound, Message: "Tool not found"}
 	}
 
-	return tool.Call(ctx, args)
+	// Middleware runs outside the cache, so it sees hits as well as misses
+	return r.wrap(WrapCall(tool, func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+		return r.callCached(ctx, tool, args)
+	})).Call(ctx, args)
 }
 
+// callCached returns the cached result of the call if there is one, and
+// invokes the tool otherwise.
+func (r *Registry) callCached(ctx context.Context, tool Tool, args json.RawMessage) (json.RawMessage, error) {
+	r.mu.RLock()
+	cache := r.cache
+	r.mu.RUnlock()
+
+	// Only tools that opt in with a positive TTL are cached
+	cacheable, ok := tool.(Cacheable)
+	if cache == nil || !ok || cacheable.CacheTTL() <= 0 {
+		return r.invoke(ctx, tool, args)
+	}
+
+	key, ok := cacheKey(ctx, tool, args)
+	if !ok {
+		return r.invoke(ctx, tool, args)
+	}
+	if result, hit := cache.get(key); hit {
+		return result, nil
+	}
+
+	result, err := r.invoke(ctx, tool, args)
+	if err != nil {
+		return nil, err
+	}
+	// A failure reported in the result may not happen next time
+	if !isErrorResult(result) {
+		cache.set(key, result, cacheable.CacheTTL())
+	}
+	return result, nil
+}
+
+// Error codes used by Error.
+const (
+	// ErrCodeToolNotFound means no tool is registered under the requested name.
+	ErrCodeToolNotFound = "tool_not_found"
+	// ErrCodeInvalidArguments means the tool rejected its arguments.
+	ErrCodeInvalidArguments = "invalid_arguments"
+	// ErrCodeUpstream means a service the tool depends on returned an error.
+	ErrCodeUpstream = "upstream_error"
+	// ErrCodeBusy means the concurrency limit was reached; retry later.
+	ErrCodeBusy = "busy"
+	// ErrCodeInvalidResult means the tool returned a malformed result.
+	ErrCodeInvalidResult = "invalid_result"
+	// ErrCodeResultTooLarge means the result exceeded the maximum size.
+	ErrCodeResultTooLarge = "result_too_large"
+)
+
 // Error represents a tool execution error.
 type Error struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
 }
 
 func (e *Error) Error() string {
 	return e.Message
 }
+
+// IsRetryable reports whether repeating the call that produced err may succeed.
+// Timeouts and errors a tool marked as retryable qualify; everything else,
+// including unknown tools and bad arguments, does not.
+func IsRetryable(err error) bool {
+	var toolErr *Error
+	if errors.As(err, &toolErr) {
+		return toolErr.Retryable
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
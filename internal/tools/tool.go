@@ -19,3 +19,15 @@ type Tool interface {
 	// The definition includes the tool's name, description, and input schema.
 	GetToolDefinition() map[string]any
 }
+
+// AnonymousCallable is implemented by tools that may report whether they can
+// be called without a session on transports that otherwise require one.
+type AnonymousCallable interface {
+	AllowAnonymous() bool
+}
+
+// Completer is implemented by tools that can suggest values for an argument.
+// Complete returns candidates for the named argument that start with prefix.
+type Completer interface {
+	Complete(ctx context.Context, argument, prefix string) ([]string, error)
+}
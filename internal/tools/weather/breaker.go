@@ -0,0 +1,136 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"mcp-sse-go/internal/tools"
+)
+
+// breaker is a circuit breaker for one upstream. After threshold consecutive
+// failures it opens and fails calls fast for cooldown, then lets a single
+// probe through; the probe's outcome closes or reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// errCircuitOpen is returned while the breaker fails calls fast.
+var errCircuitOpen = &tools.Error{
+	Code:      tools.ErrCodeUpstream,
+	Message:   "weather API is unavailable; failing fast until it recovers",
+	Retryable: true,
+}
+
+// allow reports whether a call may proceed. Once the cooldown has passed,
+// only one call at a time is let through to probe the upstream.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends an allowed call without recording an outcome, for calls that
+// never got an answer from the upstream.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// healthy reports whether the breaker has seen no failures since its last
+// success, so dropping it loses nothing.
+func (b *breaker) healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures == 0 && !b.probing
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// maxBreakers bounds the breakers kept at once. The upstream URL comes from
+// the X-Weather-API-URL header, so callers could otherwise grow the map
+// without limit.
+const maxBreakers = 256
+
+// breakers holds one breaker per upstream URL, since each caller may point
+// the tool at a different API.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	byURL     map[string]*breaker
+	mu        sync.Mutex
+}
+
+// get returns the breaker for apiURL, creating it if needed. Once
+// maxBreakers are held, healthy ones are dropped to make room; if none are,
+// get returns nil and the call goes unguarded.
+func (bs *breakers) get(apiURL string) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b, exists := bs.byURL[apiURL]
+	if exists {
+		return b
+	}
+	if len(bs.byURL) >= maxBreakers {
+		for u, other := range bs.byURL {
+			if other.healthy() {
+				delete(bs.byURL, u)
+			}
+		}
+		if len(bs.byURL) >= maxBreakers {
+			return nil
+		}
+	}
+
+	b = &breaker{threshold: bs.threshold, cooldown: bs.cooldown, now: time.Now}
+	bs.byURL[apiURL] = b
+	return b
+}
+
+// upstreamFailed reports whether err means the upstream is unhealthy. Client
+// errors such as a bad API key, or the caller giving up, say nothing about
+// its health.
+func upstreamFailed(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var toolErr *tools.Error
+	if errors.As(err, &toolErr) {
+		return toolErr.Retryable
+	}
+	return err != nil
+}
@@ -0,0 +1,131 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mcp-sse-go/internal/tools"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestBreaker returns a breaker that opens after three failures for a
+// minute, on a fake clock.
+func newTestBreaker() (*breaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	return &breaker{threshold: 3, cooldown: time.Minute, now: clock.Now}, clock
+}
+
+// fail records n failed calls, which must all be allowed.
+func fail(t *testing.T, b *breaker, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d refused before the breaker opened", i+1)
+		}
+		b.record(true)
+	}
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, clock := newTestBreaker()
+
+	fail(t, b, 2)
+	// A success resets the count
+	b.allow()
+	b.record(false)
+	fail(t, b, 2)
+	if !b.allow() {
+		t.Fatal("call refused after two consecutive failures, want allowed")
+	}
+	b.record(true)
+
+	if b.allow() {
+		t.Fatal("call allowed after three consecutive failures, want refused")
+	}
+	clock.Advance(59 * time.Second)
+	if b.allow() {
+		t.Fatal("call allowed during the cooldown, want refused")
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b, clock := newTestBreaker()
+	fail(t, b, 3)
+	clock.Advance(time.Minute)
+
+	// One probe at a time once the cooldown has passed
+	if !b.allow() {
+		t.Fatal("probe refused after the cooldown, want allowed")
+	}
+	if b.allow() {
+		t.Fatal("second call allowed while probing, want refused")
+	}
+
+	// A failed probe reopens the breaker for another cooldown
+	b.record(true)
+	if b.allow() {
+		t.Fatal("call allowed after a failed probe, want refused")
+	}
+	clock.Advance(time.Minute)
+
+	// A successful probe closes it
+	if !b.allow() {
+		t.Fatal("probe refused after the second cooldown, want allowed")
+	}
+	b.record(false)
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d refused after a successful probe, want allowed", i+1)
+		}
+	}
+	if !b.healthy() {
+		t.Fatal("breaker unhealthy after a successful probe")
+	}
+}
+
+func TestBreakerReleaseEndsProbe(t *testing.T) {
+	b, clock := newTestBreaker()
+	fail(t, b, 3)
+	clock.Advance(time.Minute)
+
+	// A probe that got no answer lets the next call probe instead
+	b.allow()
+	b.release()
+	if !b.allow() {
+		t.Fatal("call refused after the probe was released, want allowed")
+	}
+}
+
+func TestUpstreamFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "success", err: nil, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "retryable", err: &tools.Error{Code: tools.ErrCodeUpstream, Retryable: true}, want: true},
+		{name: "bad API key", err: &tools.Error{Code: tools.ErrCodeUpstream}, want: false},
+		{name: "other", err: errors.New("connection refused"), want: true},
+	}
+	for _, tt := range tests {
+		if got := upstreamFailed(tt.err); got != tt.want {
+			t.Errorf("%s: upstreamFailed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,21 +2,130 @@ package weather
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mcp-sse-go/internal/tools"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// Args represents the arguments for the weather tool.
+// Args represents the arguments for the weather tool. The location is given
+// either as City or as Lat and Lon, never both.
 type Args struct {
-	City string `json:"city"`
+	City        string          `json:"city,omitempty"`
+	Lat         *float64        `json:"lat,omitempty"`
+	Lon         *float64        `json:"lon,omitempty"`
+	OnAmbiguous AmbiguityPolicy `json:"on_ambiguous,omitempty"`
 }
 
+// query returns the upstream q parameter for the location in a, or an error
+// unless exactly one location form is given.
+func (a Args) query() (string, error) {
+	hasCoords := a.Lat != nil || a.Lon != nil
+	switch {
+	case a.City != "" && hasCoords:
+		return "", &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: "city and lat/lon are mutually exclusive"}
+	case hasCoords:
+		if a.Lat == nil || a.Lon == nil {
+			return "", &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: "lat and lon must be given together"}
+		}
+		if *a.Lat < -90 || *a.Lat > 90 || *a.Lon < -180 || *a.Lon > 180 {
+			return "", &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: "lat must be within [-90, 90] and lon within [-180, 180]"}
+		}
+		return strconv.FormatFloat(*a.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(*a.Lon, 'f', -1, 64), nil
+	case a.City != "":
+		return a.City, nil
+	}
+	return "", &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: "city or lat/lon is required"}
+}
+
+// AmbiguityPolicy controls what the weather tool does when a city name
+// matches more than one location.
+type AmbiguityPolicy string
+
+const (
+	// AmbiguityFirst uses the provider's best match.
+	AmbiguityFirst AmbiguityPolicy = "first"
+	// AmbiguityList returns the matching locations so the caller can pick one.
+	AmbiguityList AmbiguityPolicy = "list"
+	// AmbiguityError fails the call when more than one location matches.
+	AmbiguityError AmbiguityPolicy = "error"
+)
+
+// Valid reports whether p is a known ambiguity policy.
+func (p AmbiguityPolicy) Valid() bool {
+	switch p {
+	case AmbiguityFirst, AmbiguityList, AmbiguityError:
+		return true
+	}
+	return false
+}
+
+// location is a single match returned by the provider's search endpoint.
+type location struct {
+	Name    string  `json:"name"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// report is the structuredContent of a weather result. A lookup fills in the
+// current conditions; an ambiguous city under AmbiguityList fills in Matches.
+type report struct {
+	Location     *location  `json:"location,omitempty"`
+	TemperatureC *float64   `json:"temperature_c,omitempty"`
+	TemperatureF *float64   `json:"temperature_f,omitempty"`
+	FeelsLikeC   *float64   `json:"feels_like_c,omitempty"`
+	Condition    string     `json:"condition,omitempty"`
+	Humidity     *int       `json:"humidity,omitempty"`
+	WindKPH      *float64   `json:"wind_kph,omitempty"`
+	Matches      []location `json:"matches,omitempty"`
+}
+
+// locationSchema is the JSON Schema of location.
+var locationSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name":    map[string]any{"type": "string"},
+		"region":  map[string]any{"type": "string"},
+		"country": map[string]any{"type": "string"},
+		"lat":     map[string]any{"type": "number"},
+		"lon":     map[string]any{"type": "number"},
+	},
+}
+
+// outputSchema is the JSON Schema of report.
+var outputSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"location":      locationSchema,
+		"temperature_c": map[string]any{"type": "number"},
+		"temperature_f": map[string]any{"type": "number"},
+		"feels_like_c":  map[string]any{"type": "number"},
+		"condition":     map[string]any{"type": "string"},
+		"humidity":      map[string]any{"type": "integer"},
+		"wind_kph":      map[string]any{"type": "number"},
+		"matches": map[string]any{
+			"type":        "array",
+			"description": "Locations matching an ambiguous city",
+			"items":       locationSchema,
+		},
+	},
+}
+
+// DefaultAPIURL is the weather API used when neither the request nor the
+// tool configuration names one.
+const DefaultAPIURL = "https://api.weatherapi.com/v1"
+
 // Context keys for storing request-specific values
 type contextKey string
 
@@ -30,33 +139,110 @@ const (
 // WeatherTool is a tool that provides weather information.
 type WeatherTool struct {
 	*tools.DefaultTool
+	ambiguityPolicy AmbiguityPolicy
+	breakers        *breakers
+	baseURL         string
 }
 
 // NewWeatherTool creates a new WeatherTool instance.
 func NewWeatherTool() *WeatherTool {
 	tool := &WeatherTool{
-		DefaultTool: tools.NewDefaultTool("weather", "Get current weather for a city"),
+		DefaultTool:     tools.NewDefaultTool("weather", "Get current weather for a city"),
+		ambiguityPolicy: AmbiguityFirst,
+		baseURL:         DefaultAPIURL,
 	}
+	tool.SetTitle("Current Weather")
+	// Looking up the weather changes nothing, however often it is repeated
+	tool.SetReadOnlyHint(true)
+	tool.SetIdempotentHint(true)
+	tool.SetOutputSchema(outputSchema)
 	// Log the creation of the weather tool
 	log.Printf("Creating new WeatherTool instance with name: %s", tool.Name())
 	return tool
 }
 
+// SetAmbiguityPolicy sets the default policy used when a city matches more
+// than one location. Callers can still override it per call with the
+// on_ambiguous argument.
+func (t *WeatherTool) SetAmbiguityPolicy(policy AmbiguityPolicy) {
+	t.ambiguityPolicy = policy
+}
+
+// SetBaseURL sets the weather API used when the request context carries no
+// URL of its own. An empty baseURL restores DefaultAPIURL.
+func (t *WeatherTool) SetBaseURL(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	t.baseURL = baseURL
+}
+
+// CacheScope scopes cached results to the API URL and key of the call, so a
+// caller is never served a result fetched with another caller's credentials
+// or from another upstream. Calls without a key are not cached.
+func (t *WeatherTool) CacheScope(ctx context.Context) (string, bool) {
+	apiKey, _ := ctx.Value(ContextKeyAPIKey).(string)
+	if apiKey == "" {
+		return "", false
+	}
+	apiURL, ok := ctx.Value(ContextKeyAPIURL).(string)
+	if !ok || apiURL == "" {
+		apiURL = t.baseURL
+	}
+
+	// Only a digest of the key is kept in memory
+	sum := sha256.Sum256([]byte(apiKey))
+	return apiURL + "\x00" + hex.EncodeToString(sum[:]), true
+}
+
+// SetCircuitBreaker makes calls to an API fail fast for cooldown once
+// threshold consecutive requests to it have failed. A threshold of zero or
+// less disables the breaker.
+func (t *WeatherTool) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		t.breakers = nil
+		return
+	}
+	t.breakers = &breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		byURL:     make(map[string]*breaker),
+	}
+}
+
 // GetToolDefinition returns the tool definition in MCP format
 func (t *WeatherTool) GetToolDefinition() map[string]any {
 	// Get the default tool definition
 	def := t.DefaultTool.GetToolDefinition()
 	
-	// Override with weather-specific schema
+	// Override with weather-specific schema. It is a flat object, as many
+	// clients reject top-level combinators; query enforces that exactly one
+	// location form is given
 	def["inputSchema"] = map[string]any{
 		"type": "object",
 		"properties": map[string]any{
 			"city": map[string]any{
 				"type":        "string",
-				"description": "The city to get weather for",
+				"description": "The city to get weather for. Give either city or both lat and lon",
+			},
+			"lat": map[string]any{
+				"type":        "number",
+				"description": "Latitude of the location, used with lon instead of city",
+				"minimum":     -90,
+				"maximum":     90,
+			},
+			"lon": map[string]any{
+				"type":        "number",
+				"description": "Longitude of the location, used with lat instead of city",
+				"minimum":     -180,
+				"maximum":     180,
+			},
+			"on_ambiguous": map[string]any{
+				"type":        "string",
+				"description": "What to do when the city matches more than one location",
+				"enum":        []string{string(AmbiguityFirst), string(AmbiguityList), string(AmbiguityError)},
 			},
 		},
-		"required": []string{"city"},
 	}
 	
 	return def
@@ -67,17 +253,18 @@ func (t *WeatherTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 	// Parse arguments
 	var params Args
 	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, fmt.Errorf("invalid arguments: %w", err)
+		return nil, &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: fmt.Sprintf("invalid arguments: %v", err)}
 	}
 
-	if params.City == "" {
-		return nil, fmt.Errorf("city is required")
+	q, err := params.query()
+	if err != nil {
+		return nil, err
 	}
 
-	// Get API URL and key from context
+	// Get API URL and key from context, falling back to the configured URL
 	apiURL, ok := ctx.Value(ContextKeyAPIURL).(string)
 	if !ok || apiURL == "" {
-		return nil, fmt.Errorf("missing or invalid API URL in context")
+		apiURL = t.baseURL
 	}
 
 	apiKey, ok := ctx.Value(ContextKeyAPIKey).(string)
@@ -85,47 +272,40 @@ func (t *WeatherTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 		return nil, fmt.Errorf("missing or invalid API key in context")
 	}
 
-	// Construct the full URL with query parameters
-	fullURL := fmt.Sprintf("%s/current.json?key=%s&q=%s&aqi=no", 
-		strings.TrimSuffix(apiURL, "/"),
-		url.QueryEscape(apiKey),
-		url.QueryEscape(params.City),
-	)
-
-	// Create request
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	policy := t.ambiguityPolicy
+	if params.OnAmbiguous != "" {
+		policy = params.OnAmbiguous
 	}
-
-	// Set headers
-	req.Header.Set("Accept", "application/json")
-
-	// Send request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if !policy.Valid() {
+		return nil, &tools.Error{Code: tools.ErrCodeInvalidArguments, Message: fmt.Sprintf("invalid on_ambiguous value: %q", policy)}
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	// The provider already resolves a name to its best match, so the search
+	// round-trip is only needed when the caller wants to see the alternatives.
+	// Coordinates name a single point and are never ambiguous.
+	if policy != AmbiguityFirst && params.City != "" {
+		var matches []location
+		if err := t.fetch(ctx, apiURL, "search.json", url.Values{
+			"key": {apiKey},
+			"q":   {q},
+		}, &matches); err != nil {
+			return nil, err
+		}
 
-	// Check for non-200 status codes
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		if len(matches) > 1 {
+			if policy == AmbiguityError {
+				return nil, &tools.Error{
+					Code:    tools.ErrCodeInvalidArguments,
+					Message: fmt.Sprintf("city %q is ambiguous: %d locations match", params.City, len(matches)),
+				}
+			}
+			return disambiguationResponse(params.City, matches)
+		}
 	}
 
 	// Parse the weather data
 	var weatherData struct {
-		Location struct {
-			Name    string `json:"name"`
-			Region  string `json:"region"`
-			Country string `json:"country"`
-		} `json:"location"`
+		Location location `json:"location"`
 		Current struct {
 			TempC     float64 `json:"temp_c"`
 			TempF     float64 `json:"temp_f"`
@@ -138,8 +318,12 @@ func (t *WeatherTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 		} `json:"current"`
 	}
 
-	if err := json.Unmarshal(body, &weatherData); err != nil {
-		return nil, fmt.Errorf("failed to parse weather data: %w", err)
+	if err := t.fetch(ctx, apiURL, "current.json", url.Values{
+		"key": {apiKey},
+		"q":   {q},
+		"aqi": {"no"},
+	}, &weatherData); err != nil {
+		return nil, err
 	}
 
 	// Format the response as markdown
@@ -159,14 +343,16 @@ func (t *WeatherTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 		weatherData.Current.WindKPH,
 	)
 
-	// The client expects a response with a specific structure
-	// Create a response that matches the client's expected format
-	response := map[string]interface{}{
-		"content": []interface{}{
-			map[string]interface{}{
-				"type": "text",
-				"text": markdown,
-			},
+	response := tools.Result{
+		Content: []tools.Content{tools.TextContent(markdown)},
+		StructuredContent: report{
+			Location:     &weatherData.Location,
+			TemperatureC: &weatherData.Current.TempC,
+			TemperatureF: &weatherData.Current.TempF,
+			FeelsLikeC:   &weatherData.Current.FeelsLikeC,
+			Condition:    weatherData.Current.Condition.Text,
+			Humidity:     &weatherData.Current.Humidity,
+			WindKPH:      &weatherData.Current.WindKPH,
 		},
 	}
 
@@ -175,3 +361,128 @@ func (t *WeatherTool) Call(ctx context.Context, args json.RawMessage) (json.RawM
 
 	return json.Marshal(response)
 }
+
+// Complete suggests on_ambiguous policies, and city names from the provider's
+// search endpoint once the prefix is long enough to search for. City
+// suggestions need an API key on the context; without one there are none.
+func (t *WeatherTool) Complete(ctx context.Context, argument, prefix string) ([]string, error) {
+	switch argument {
+	case "on_ambiguous":
+		var values []string
+		for _, p := range []AmbiguityPolicy{AmbiguityFirst, AmbiguityList, AmbiguityError} {
+			if strings.HasPrefix(string(p), prefix) {
+				values = append(values, string(p))
+			}
+		}
+		return values, nil
+	case "city":
+		apiKey, _ := ctx.Value(ContextKeyAPIKey).(string)
+		if apiKey == "" || len(prefix) < minCityCompletionPrefix {
+			return nil, nil
+		}
+		apiURL, ok := ctx.Value(ContextKeyAPIURL).(string)
+		if !ok || apiURL == "" {
+			apiURL = t.baseURL
+		}
+
+		var matches []location
+		if err := t.fetch(ctx, apiURL, "search.json", url.Values{
+			"key": {apiKey},
+			"q":   {prefix},
+		}, &matches); err != nil {
+			return nil, err
+		}
+
+		values := make([]string, 0, len(matches))
+		for _, m := range matches {
+			values = append(values, fmt.Sprintf("%s, %s, %s", m.Name, m.Region, m.Country))
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+// minCityCompletionPrefix is the shortest prefix city completion searches
+// for, so a keystroke or two doesn't cost an upstream request.
+const minCityCompletionPrefix = 3
+
+// disambiguationResponse lists the locations matching city as text content
+// so the caller can retry with a more specific name.
+func disambiguationResponse(city string, matches []location) (json.RawMessage, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Multiple locations match %q\n", city)
+	for _, m := range matches {
+		fmt.Fprintf(&b, "\n- %s, %s, %s (%.2f, %.2f)", m.Name, m.Region, m.Country, m.Lat, m.Lon)
+	}
+
+	response := tools.Result{
+		Content:           []tools.Content{tools.TextContent(b.String())},
+		StructuredContent: report{Matches: matches},
+	}
+	return json.Marshal(response)
+}
+
+// fetch calls the package-level fetch through the API's circuit breaker.
+func (t *WeatherTool) fetch(ctx context.Context, apiURL, endpoint string, query url.Values, v any) error {
+	if t.breakers == nil {
+		return fetch(ctx, apiURL, endpoint, query, v)
+	}
+
+	b := t.breakers.get(apiURL)
+	if b == nil {
+		return fetch(ctx, apiURL, endpoint, query, v)
+	}
+	if !b.allow() {
+		return errCircuitOpen
+	}
+	err := fetch(ctx, apiURL, endpoint, query, v)
+	if errors.Is(err, context.Canceled) {
+		b.release()
+		return err
+	}
+	b.record(upstreamFailed(err))
+	return err
+}
+
+// fetch performs a GET against the given provider endpoint and decodes the
+// JSON response into v.
+func fetch(ctx context.Context, apiURL, endpoint string, query url.Values, v any) error {
+	// Construct the full URL with query parameters
+	fullURL := fmt.Sprintf("%s/%s?%s", strings.TrimSuffix(apiURL, "/"), endpoint, query.Encode())
+
+	// Create request
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Accept", "application/json")
+
+	// Send request
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Check for non-200 status codes
+	if resp.StatusCode != http.StatusOK {
+		return &tools.Error{
+			Code:      tools.ErrCodeUpstream,
+			Message:   fmt.Sprintf("unexpected status code: %d, body: %s", resp.StatusCode, string(body)),
+			Retryable: resp.StatusCode >= http.StatusInternalServerError,
+		}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse weather data: %w", err)
+	}
+	return nil
+}
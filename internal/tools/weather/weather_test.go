@@ -0,0 +1,216 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mcp-sse-go/internal/tools"
+)
+
+func TestArgsQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string
+		ok   bool
+	}{
+		{name: "city", args: `{"city":"London"}`, want: "London", ok: true},
+		{name: "coordinates", args: `{"lat":51.5,"lon":-0.12}`, want: "51.5,-0.12", ok: true},
+		{name: "both", args: `{"city":"London","lat":51.5,"lon":-0.12}`},
+		{name: "neither", args: `{}`},
+		{name: "lat only", args: `{"lat":51.5}`},
+		{name: "out of range", args: `{"lat":91,"lon":0}`},
+	}
+	for _, tt := range tests {
+		var args Args
+		if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+			t.Fatal(err)
+		}
+		q, err := args.query()
+		if tt.ok {
+			if err != nil || q != tt.want {
+				t.Errorf("%s: query() = %q, %v; want %q", tt.name, q, err, tt.want)
+			}
+			continue
+		}
+		var toolErr *tools.Error
+		if !errors.As(err, &toolErr) || toolErr.Code != tools.ErrCodeInvalidArguments {
+			t.Errorf("%s: query() = %q, %v; want an invalid arguments error", tt.name, q, err)
+		}
+	}
+}
+
+func TestInputSchemaIsFlat(t *testing.T) {
+	schema := NewWeatherTool().GetToolDefinition()["inputSchema"].(map[string]any)
+
+	if schema["type"] != "object" {
+		t.Fatalf("type = %v, want object", schema["type"])
+	}
+	for _, combinator := range []string{"oneOf", "anyOf", "allOf", "required"} {
+		if _, ok := schema[combinator]; ok {
+			t.Errorf("schema has %s; every location field must be optional", combinator)
+		}
+	}
+	properties := schema["properties"].(map[string]any)
+	for _, name := range []string{"city", "lat", "lon"} {
+		property, ok := properties[name].(map[string]any)
+		if !ok || property["description"] == "" {
+			t.Errorf("property %s = %v, want a described property", name, properties[name])
+		}
+	}
+}
+
+// newFakeAPI serves search.json with matches and current.json with a fixed
+// reading, counting the searches made.
+func newFakeAPI(t *testing.T, matches []location, searches *int) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search.json":
+			*searches++
+			json.NewEncoder(w).Encode(matches)
+		case "/current.json":
+			json.NewEncoder(w).Encode(map[string]any{
+				"location": matches[0],
+				"current":  map[string]any{"temp_c": 18.5, "condition": map[string]any{"text": "Cloudy"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAmbiguityPolicies(t *testing.T) {
+	springfields := []location{
+		{Name: "Springfield", Region: "Illinois", Country: "USA", Lat: 39.8, Lon: -89.64},
+		{Name: "Springfield", Region: "Missouri", Country: "USA", Lat: 37.22, Lon: -93.3},
+		{Name: "Springfield", Region: "Massachusetts", Country: "USA", Lat: 42.1, Lon: -72.59},
+	}
+	paris := []location{{Name: "Paris", Region: "Ile-de-France", Country: "France", Lat: 48.87, Lon: 2.33}}
+
+	tests := []struct {
+		name     string
+		policy   AmbiguityPolicy
+		matches  []location
+		searches int
+		// listed is how many locations the result lists; zero means a
+		// weather report is expected instead
+		listed  int
+		invalid bool
+	}{
+		{name: "first uses the best match", policy: AmbiguityFirst, matches: springfields},
+		{name: "list returns the matches", policy: AmbiguityList, matches: springfields, searches: 1, listed: 3},
+		{name: "error rejects the city", policy: AmbiguityError, matches: springfields, searches: 1, invalid: true},
+		{name: "list with one match reports weather", policy: AmbiguityList, matches: paris, searches: 1},
+		{name: "error with one match reports weather", policy: AmbiguityError, matches: paris, searches: 1},
+	}
+	for _, tt := range tests {
+		var searches int
+		srv := newFakeAPI(t, tt.matches, &searches)
+		tool := NewWeatherTool()
+		tool.SetBaseURL(srv.URL)
+		tool.SetAmbiguityPolicy(tt.policy)
+		ctx := context.WithValue(context.Background(), ContextKeyAPIKey, "test-key")
+
+		raw, err := tool.Call(ctx, json.RawMessage(`{"city":"`+tt.matches[0].Name+`"}`))
+		if searches != tt.searches {
+			t.Errorf("%s: %d searches, want %d", tt.name, searches, tt.searches)
+		}
+		if tt.invalid {
+			var toolErr *tools.Error
+			if !errors.As(err, &toolErr) || toolErr.Code != tools.ErrCodeInvalidArguments {
+				t.Errorf("%s: error = %v, want an invalid arguments error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Call: %v", tt.name, err)
+			continue
+		}
+
+		var result struct {
+			StructuredContent report `json:"structuredContent"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatalf("%s: failed to decode %s: %v", tt.name, raw, err)
+		}
+		r := result.StructuredContent
+		if tt.listed > 0 {
+			if len(r.Matches) != tt.listed || r.TemperatureC != nil {
+				t.Errorf("%s: result = %s, want %d matches and no reading", tt.name, raw, tt.listed)
+			}
+			continue
+		}
+		if r.TemperatureC == nil || *r.TemperatureC != 18.5 || len(r.Matches) != 0 {
+			t.Errorf("%s: result = %s, want the weather reading", tt.name, raw)
+		}
+	}
+}
+
+func TestAmbiguityPolicyOverriddenPerCall(t *testing.T) {
+	var searches int
+	srv := newFakeAPI(t, []location{{Name: "Portland"}, {Name: "Portland"}}, &searches)
+	tool := NewWeatherTool()
+	tool.SetBaseURL(srv.URL)
+	ctx := context.WithValue(context.Background(), ContextKeyAPIKey, "test-key")
+
+	_, err := tool.Call(ctx, json.RawMessage(`{"city":"Portland","on_ambiguous":"error"}`))
+	var toolErr *tools.Error
+	if !errors.As(err, &toolErr) || toolErr.Code != tools.ErrCodeInvalidArguments {
+		t.Fatalf("error = %v, want the per-call error policy to apply", err)
+	}
+
+	_, err = tool.Call(ctx, json.RawMessage(`{"city":"Portland","on_ambiguous":"sometimes"}`))
+	if !errors.As(err, &toolErr) || toolErr.Code != tools.ErrCodeInvalidArguments {
+		t.Fatalf("error = %v, want an unknown policy rejected", err)
+	}
+}
+
+func TestAPIURLDefaultAndOverride(t *testing.T) {
+	// A fresh tool, and one whose base URL was cleared, use the public API
+	key := context.WithValue(context.Background(), ContextKeyAPIKey, "test-key")
+	tool := NewWeatherTool()
+	if scope, _ := tool.CacheScope(key); !strings.HasPrefix(scope, DefaultAPIURL+"\x00") {
+		t.Errorf("scope = %q, want the default API URL", scope)
+	}
+	tool.SetBaseURL("http://example.invalid")
+	tool.SetBaseURL("")
+	if scope, _ := tool.CacheScope(key); !strings.HasPrefix(scope, DefaultAPIURL+"\x00") {
+		t.Errorf("scope after clearing = %q, want the default API URL", scope)
+	}
+
+	paris := []location{{Name: "Paris", Country: "France"}}
+	var baseSearches, overrideSearches int
+	base := newFakeAPI(t, paris, &baseSearches)
+	override := newFakeAPI(t, paris, &overrideSearches)
+	tool.SetBaseURL(base.URL)
+	tool.SetAmbiguityPolicy(AmbiguityList)
+
+	tests := []struct {
+		name                   string
+		ctx                    context.Context
+		wantBase, wantOverride int
+	}{
+		{name: "no URL in context", ctx: key, wantBase: 1},
+		{name: "empty URL in context", ctx: context.WithValue(key, ContextKeyAPIURL, ""), wantBase: 1},
+		{name: "URL in context", ctx: context.WithValue(key, ContextKeyAPIURL, override.URL), wantOverride: 1},
+	}
+	for _, tt := range tests {
+		baseSearches, overrideSearches = 0, 0
+		if _, err := tool.Call(tt.ctx, json.RawMessage(`{"city":"Paris"}`)); err != nil {
+			t.Errorf("%s: Call: %v", tt.name, err)
+			continue
+		}
+		if baseSearches != tt.wantBase || overrideSearches != tt.wantOverride {
+			t.Errorf("%s: %d base and %d override searches, want %d and %d", tt.name, baseSearches, overrideSearches, tt.wantBase, tt.wantOverride)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Package version holds build metadata, injected at link time with
+// -ldflags "-X mcp-sse-go/internal/version.Version=...".
+package version
+
+// Build metadata. The defaults describe a plain `go build`.
+var (
+	// Version is the release version of the server.
+	Version = "0.1.0"
+	// Commit is the git commit the binary was built from.
+	Commit = "unknown"
+	// BuildTime is when the binary was built, in RFC 3339.
+	BuildTime = "unknown"
+)
+
+// Info is the build metadata served by /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	}
+}
@@ -0,0 +1,375 @@
+// Package client is a minimal MCP client for the server's legacy SSE
+// transport. It opens the event stream, POSTs requests to the endpoint the
+// server announces and matches the responses arriving on the stream to
+// their requests by id.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"mcp-sse-go/pkg/tools"
+)
+
+// ErrClosed is returned by calls made on, or interrupted by, a closed client.
+var ErrClosed = errors.New("client closed")
+
+// Error is a JSON-RPC error returned by the server.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// Notification is a message the server sent without being asked.
+type Notification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response read from the stream.
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests with c instead of http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.http = c
+	}
+}
+
+// WithHeader adds a header to every request, e.g. X-Weather-API-Key or an
+// API key.
+func WithHeader(name, value string) Option {
+	return func(cl *Client) {
+		cl.header.Add(name, value)
+	}
+}
+
+// Client is a connection to an MCP server's SSE endpoint.
+type Client struct {
+	http     *http.Client
+	header   http.Header
+	endpoint string
+	body     io.ReadCloser
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan *response
+	closed  chan struct{}
+	once    sync.Once
+
+	notifications chan Notification
+}
+
+// Dial opens the SSE stream at sseURL, e.g. "http://localhost:8080/sse", and
+// waits for the server to announce where requests are to be POSTed.
+func Dial(ctx context.Context, sseURL string, opts ...Option) (*Client, error) {
+	c := &Client{
+		http:          http.DefaultClient,
+		header:        make(http.Header),
+		pending:       make(map[string]chan *response),
+		closed:        make(chan struct{}),
+		notifications: make(chan Notification, 64),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to open stream: unexpected status %s", resp.Status)
+	}
+	c.body = resp.Body
+
+	events := bufio.NewReader(resp.Body)
+	event, data, err := readEvent(events)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read endpoint event: %w", err)
+	}
+	if event != "endpoint" {
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected endpoint event, got %q", event)
+	}
+
+	base, _ := url.Parse(sseURL)
+	endpoint, err := base.Parse(string(data))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid endpoint %q: %w", data, err)
+	}
+	c.endpoint = endpoint.String()
+
+	go c.readStream(events)
+	return c, nil
+}
+
+// Notifications returns the server's notifications. Notifications that
+// arrive while the channel is full are dropped.
+func (c *Client) Notifications() <-chan Notification {
+	return c.notifications
+}
+
+// Close closes the stream, failing any calls still waiting for a response.
+func (c *Client) Close() error {
+	c.shutdown()
+	return c.body.Close()
+}
+
+// Call sends a request and decodes its result into result, which may be nil.
+// A JSON-RPC error from the server is returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      json.RawMessage(id),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Registered before sending, as the response may beat the POST's reply
+	ch := make(chan *response, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.post(ctx, body); err != nil {
+		return err
+	}
+
+	select {
+	case r := <-ch:
+		if r.Error != nil {
+			return r.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(r.Result, result); err != nil {
+			return fmt.Errorf("failed to decode result: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
+// Notify sends a notification, which the server does not answer.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return c.post(ctx, body)
+}
+
+// Initialize performs the MCP handshake, including the
+// notifications/initialized that completes it, and returns the server's
+// result.
+func (c *Client) Initialize(ctx context.Context) (map[string]any, error) {
+	var result map[string]any
+	err := c.Call(ctx, "initialize", map[string]any{
+		"protocolVersion": "2025-03-26",
+		"clientInfo":      map[string]any{"name": "mcp-sse-go-client"},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListTools returns the definitions of every tool the server offers.
+func (c *Client) ListTools(ctx context.Context) ([]map[string]any, error) {
+	var result struct {
+		Tools []map[string]any `json:"tools"`
+	}
+	if err := c.Call(ctx, "tools/list", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tools, nil
+}
+
+// CallTool calls the named tool. A tool that fails reports it with
+// Result.IsError rather than an error.
+func (c *Client) CallTool(ctx context.Context, name string, args any) (*tools.Result, error) {
+	var result tools.Result
+	err := c.Call(ctx, "tools/call", map[string]any{
+		"name":      name,
+		"arguments": args,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// post POSTs a message to the endpoint. The server accepts it with 202 and
+// answers on the stream; anything else is a rejection, returned as *Error
+// when the body carries a JSON-RPC error.
+func (c *Client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	var rejection response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBody)).Decode(&rejection); err == nil && rejection.Error != nil {
+		return rejection.Error
+	}
+	return fmt.Errorf("request rejected: unexpected status %s", resp.Status)
+}
+
+// maxErrorBody bounds how much of a rejected POST's body is read.
+const maxErrorBody = 64 << 10
+
+// setHeaders adds the configured headers to req.
+func (c *Client) setHeaders(req *http.Request) {
+	for name, values := range c.header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+}
+
+// readStream delivers the stream's messages until it ends.
+func (c *Client) readStream(events *bufio.Reader) {
+	defer c.shutdown()
+
+	for {
+		event, data, err := readEvent(events)
+		if err != nil {
+			return
+		}
+		if event != "message" {
+			continue
+		}
+
+		var msg response
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		if msg.ID == nil {
+			select {
+			case c.notifications <- Notification{Method: msg.Method, Params: msg.Params}:
+			default:
+			}
+			continue
+		}
+
+		// Taken out of pending on delivery, so a duplicate or late response
+		// for the id is dropped instead of blocking on the full channel
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+	}
+}
+
+// shutdown marks the client closed, once.
+func (c *Client) shutdown() {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+}
+
+// readEvent reads one SSE event, skipping comments such as keep-alives.
+// Events without a name are "message" events.
+func readEvent(r *bufio.Reader) (string, []byte, error) {
+	event := ""
+	var data []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if data == nil && event == "" {
+				continue
+			}
+			if event == "" {
+				event = "message"
+			}
+			return event, data, nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			chunk := strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, chunk...)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mcp-sse-go/internal/jsonrpc"
+	"mcp-sse-go/internal/server"
+	"mcp-sse-go/pkg/tools"
+)
+
+// greeter greets the name it is given.
+type greeter struct{}
+
+func (greeter) Name() string { return "greet" }
+
+func (greeter) Call(args json.RawMessage) (json.RawMessage, error) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tools.Result{Content: []tools.Content{tools.TextContent("Hello, " + params.Name)}})
+}
+
+// methodRecorder records the JSON-RPC method of every POST it passes on.
+type methodRecorder struct {
+	next    http.Handler
+	mu      sync.Mutex
+	methods []string
+}
+
+func (m *methodRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var msg struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal(body, &msg)
+		m.mu.Lock()
+		m.methods = append(m.methods, msg.Method)
+		m.mu.Unlock()
+	}
+	m.next.ServeHTTP(w, r)
+}
+
+// newServer starts the MCP server with the greet tool and returns it with
+// a record of the methods POSTed to it.
+func newServer(t *testing.T, cfg server.Config) (*httptest.Server, *methodRecorder) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logger := zerolog.Nop()
+	cfg.Logger = &logger
+	cfg.Context = ctx
+	cfg.DisableWeatherTool = true
+	cfg.Tools = append(cfg.Tools, tools.Adapt(greeter{}))
+	handler, err := server.New(cfg)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+
+	recorder := &methodRecorder{next: handler}
+	srv := httptest.NewServer(recorder)
+	t.Cleanup(srv.Close)
+	t.Cleanup(cancel)
+	return srv, recorder
+}
+
+// dial connects a client to srv, closing it when the test ends. The dial
+// context bounds the stream, so it is only cancelled then too.
+func dial(t *testing.T, srv *httptest.Server, opts ...Option) *Client {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, err := Dial(ctx, srv.URL+"/sse", opts...)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestToolCallFlow(t *testing.T) {
+	srv, recorder := newServer(t, server.Config{})
+	c := dial(t, srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if info, _ := result["serverInfo"].(map[string]any); info["name"] != "mcp-sse-go" {
+		t.Fatalf("serverInfo = %v, want mcp-sse-go", result["serverInfo"])
+	}
+
+	defs, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(defs) != 1 || defs[0]["name"] != "greet" {
+		t.Fatalf("tools = %v, want greet", defs)
+	}
+
+	res, err := c.CallTool(ctx, "greet", map[string]string{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if res.IsError || len(res.Content) != 1 || res.Content[0].Text != "Hello, Ada" {
+		t.Fatalf("result = %+v, want the greeting", res)
+	}
+
+	// Initialize completes the handshake before anything else is sent
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	want := []string{"initialize", "notifications/initialized", "tools/list", "tools/call"}
+	if fmt.Sprint(recorder.methods) != fmt.Sprint(want) {
+		t.Fatalf("methods sent = %v, want %v", recorder.methods, want)
+	}
+}
+
+func TestCallReturnsJSONRPCError(t *testing.T) {
+	srv, _ := newServer(t, server.Config{})
+	c := dial(t, srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.CallTool(ctx, "missing", nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != int(jsonrpc.InvalidParams) {
+		t.Fatalf("CallTool = %v, want an invalid params *Error", err)
+	}
+}
+
+func TestHeadersSent(t *testing.T) {
+	srv, _ := newServer(t, server.Config{APIKeys: []string{"secret"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := Dial(ctx, srv.URL+"/sse"); err == nil {
+		t.Fatal("Dial without the API key succeeded")
+	}
+
+	c := dial(t, srv, WithHeader(server.DefaultAPIKeyHeader, "secret"))
+	if _, err := c.ListTools(ctx); err != nil {
+		t.Fatalf("ListTools with the API key: %v", err)
+	}
+}
+
+func TestRejectedPostReturnsError(t *testing.T) {
+	// A server that announces an endpoint, then rejects every POST with a
+	// JSON-RPC error in the body, as the request timeout does
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: endpoint\ndata: /sse?sessionId=1\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Request timed out"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	c := dial(t, srv)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.Call(ctx, "tools/list", nil, nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "Request timed out" {
+		t.Fatalf("Call = %v, want the JSON-RPC error from the body", err)
+	}
+
+	if err := c.Notify(ctx, "notifications/initialized", nil); err == nil || !strings.Contains(err.Error(), "Request timed out") {
+		t.Fatalf("Notify = %v, want the JSON-RPC error from the body", err)
+	}
+}
+
+func TestCloseFailsPendingCalls(t *testing.T) {
+	srv, _ := newServer(t, server.Config{})
+	c := dial(t, srv)
+	c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.ListTools(ctx); err == nil {
+		t.Fatal("ListTools on a closed client succeeded")
+	}
+}
+
+func TestDuplicateResponseDoesNotBlockStream(t *testing.T) {
+	second := make(chan *response, 1)
+	c := &Client{
+		pending:       map[string]chan *response{"1": make(chan *response, 1), "2": second},
+		closed:        make(chan struct{}),
+		notifications: make(chan Notification, 1),
+	}
+	stream := `event: message
+data: {"jsonrpc":"2.0","id":1,"result":{}}
+
+event: message
+data: {"jsonrpc":"2.0","id":1,"result":{}}
+
+event: message
+data: {"jsonrpc":"2.0","id":2,"result":{}}
+
+`
+	go c.readStream(bufio.NewReader(strings.NewReader(stream)))
+
+	// Nobody reads id 1's response, yet id 2's still arrives
+	select {
+	case <-second:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the duplicate response for id 1 blocked the stream")
+	}
+}
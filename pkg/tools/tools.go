@@ -1,11 +1,101 @@
+// Package tools is the public face of the server's tool API. Its types are
+// aliases of the internal ones, so tools built against this package can be
+// registered with the server's registry directly.
 package tools
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
 
-// Tool is the interface that all tools must implement.
+	"mcp-sse-go/internal/tools"
+)
+
+// ContextTool is the interface registered tools implement: Call receives the
+// request context, and GetToolDefinition describes the tool in MCP format.
+type ContextTool = tools.Tool
+
+// Tool is the context-free tool interface this package originally exposed.
 // The argument is a json.RawMessage, which allows for flexible parameter passing.
 // The return value is a json.RawMessage, which allows for flexible return values.
 type Tool interface {
 	Name() string
 	Call(args json.RawMessage) (json.RawMessage, error)
 }
+
+type (
+	// Registry manages the collection of available tools.
+	Registry = tools.Registry
+	// DefaultTool is a base implementation of ContextTool that can be
+	// embedded in other tools.
+	DefaultTool = tools.DefaultTool
+	// Error is a tool failure carrying a machine-readable code.
+	Error = tools.Error
+	// Content is one item of a tool result's content.
+	Content = tools.Content
+	// Result is the MCP result of a tool call.
+	Result = tools.Result
+)
+
+// NewRegistry creates a new tool registry.
+func NewRegistry() *Registry {
+	return tools.NewRegistry()
+}
+
+// NewDefaultTool creates a new DefaultTool with the given name and description.
+func NewDefaultTool(name, description string) *DefaultTool {
+	return tools.NewDefaultTool(name, description)
+}
+
+// TextContent returns a text content item.
+func TextContent(text string) Content {
+	return tools.TextContent(text)
+}
+
+// Adapt wraps a context-free Tool so it can be registered with a Registry.
+// The request context is not passed on. Tools that also have a
+// GetToolDefinition method keep their definition; others get one with just
+// the name and an input schema accepting any object. Results without an MCP
+// content array, as legacy tools return, are sent as a single text item
+// holding the JSON.
+func Adapt(tool Tool) ContextTool {
+	return &adapter{tool: tool}
+}
+
+// adapter is a context-free Tool presented as a ContextTool.
+type adapter struct {
+	tool Tool
+}
+
+// Name returns the wrapped tool's name.
+func (a *adapter) Name() string {
+	return a.tool.Name()
+}
+
+// Call calls the wrapped tool, ignoring ctx, and wraps a result that is not
+// in MCP form.
+func (a *adapter) Call(_ context.Context, args json.RawMessage) (json.RawMessage, error) {
+	result, err := a.tool.Call(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Content *[]json.RawMessage `json:"content"`
+	}
+	if json.Unmarshal(result, &r) == nil && r.Content != nil {
+		return result, nil
+	}
+	return json.Marshal(Result{Content: []Content{TextContent(string(result))}})
+}
+
+// GetToolDefinition returns the wrapped tool's definition if it has one.
+func (a *adapter) GetToolDefinition() map[string]any {
+	if d, ok := a.tool.(interface{ GetToolDefinition() map[string]any }); ok {
+		return d.GetToolDefinition()
+	}
+	return map[string]any{
+		"name":        a.tool.Name(),
+		"description": "",
+		"inputSchema": map[string]any{"type": "object"},
+	}
+}
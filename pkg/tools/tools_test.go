@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	internaltools "mcp-sse-go/internal/tools"
+)
+
+// legacyWeatherTool is a weather tool written against the context-free Tool
+// interface, returning its reading as plain JSON.
+type legacyWeatherTool struct{}
+
+func (legacyWeatherTool) Name() string {
+	return "weather"
+}
+
+func (legacyWeatherTool) Call(args json.RawMessage) (json.RawMessage, error) {
+	var params struct {
+		City string `json:"city"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{"city": params.City, "temp_c": 21.5})
+}
+
+func TestAdaptedToolCallsThroughRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Adapt(legacyWeatherTool{}))
+
+	raw, err := r.Call(context.Background(), "weather", json.RawMessage(`{"city":"Paris"}`))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var result Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode %s: %v", raw, err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != `{"city":"Paris","temp_c":21.5}` {
+		t.Fatalf("result = %s, want the legacy JSON as one text item", raw)
+	}
+
+	def := r.List()["weather"].GetToolDefinition()
+	if def["name"] != "weather" {
+		t.Fatalf("definition = %v, want the tool's name", def)
+	}
+}
+
+// mcpTool is a context-free tool that already returns MCP results.
+type mcpTool struct{}
+
+func (mcpTool) Name() string {
+	return "mcp"
+}
+
+func (mcpTool) Call(args json.RawMessage) (json.RawMessage, error) {
+	return json.Marshal(Result{Content: []Content{TextContent("hello")}})
+}
+
+func TestAdaptKeepsMCPResults(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Adapt(mcpTool{}))
+
+	raw, err := r.Call(context.Background(), "mcp", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var result Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode %s: %v", raw, err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Fatalf("result = %s, want it unchanged", raw)
+	}
+}
+
+// greetKey is the context key greetTool reads the caller's name from.
+type greetKey struct{}
+
+// greetTool is built on this package's DefaultTool and greets the caller
+// named in its context.
+type greetTool struct {
+	*DefaultTool
+}
+
+func (greetTool) Call(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+	name, _ := ctx.Value(greetKey{}).(string)
+	if name == "" {
+		return nil, &Error{Code: internaltools.ErrCodeInvalidArguments, Message: "no caller"}
+	}
+	return json.Marshal(Result{Content: []Content{TextContent("hello " + name)}})
+}
+
+func TestPublicToolRegistersWithInternalRegistry(t *testing.T) {
+	// The server's registry accepts the tool as is, and passes it the context
+	r := internaltools.NewRegistry()
+	r.Register(greetTool{NewDefaultTool("greet", "Greets the caller")})
+
+	ctx := context.WithValue(context.Background(), greetKey{}, "Ada")
+	raw, err := r.Call(ctx, "greet", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var result internaltools.Result
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode %s: %v", raw, err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hello Ada" {
+		t.Fatalf("result = %s, want the caller greeted", raw)
+	}
+
+	def := r.List()["greet"].GetToolDefinition()
+	if def["name"] != "greet" || def["description"] != "Greets the caller" {
+		t.Fatalf("definition = %v, want the tool's name and description", def)
+	}
+
+	// Errors keep their code across the package boundary
+	_, err = r.Call(context.Background(), "greet", json.RawMessage(`{}`))
+	var toolErr *internaltools.Error
+	if !errors.As(err, &toolErr) || toolErr.Code != internaltools.ErrCodeInvalidArguments {
+		t.Fatalf("error = %v, want an invalid arguments error", err)
+	}
+
+	// A registry made here is the server's registry type
+	var _ *internaltools.Registry = NewRegistry()
+}